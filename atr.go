@@ -0,0 +1,137 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	// atrPeriod is the number of daily bars averaged into the ATR
+	atrPeriod = 14
+
+	// historyTimeout is how long to wait for TWS to send historical bars
+	historyTimeout = 30 * time.Second
+)
+
+// atrValue is an ATR worked out from the daily bars before day
+type atrValue struct {
+	value float64
+	day   string
+}
+
+// dailyBars requests the last few months of daily bars for a contract
+func (m *IBManager) dailyBars(contract ib.Contract) ([]ib.HistoricalDataItem, error) {
+	id := m.nextRequestID()
+	req := &ib.RequestHistoricalData{
+		Contract:    contract,
+		EndDateTime: time.Now(),
+		Duration:    "3 M",
+		BarSize:     ib.HistBarSize1Day,
+		WhatToShow:  ib.HistTrades,
+		UseRTH:      true,
+	}
+	if contract.SecurityType == "CASH" {
+		req.WhatToShow = ib.HistMidpoint
+	}
+	req.SetID(id)
+
+	replies, err := m.request(req, byID(id), func(r ib.Reply) bool {
+		_, ok := r.(*ib.HistoricalData)
+		return ok
+	}, historyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range replies {
+		if r, ok := r.(*ib.HistoricalData); ok {
+			return r.Data, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: no historical data for %s", m.label, contract.Symbol)
+}
+
+// averageTrueRange is Wilder's average true range over period bars
+func averageTrueRange(bars []ib.HistoricalDataItem, period int) (float64, error) {
+	if len(bars) < period+1 {
+		return 0, fmt.Errorf("only %d daily bars, the ATR needs %d", len(bars), period+1)
+	}
+
+	var atr float64
+	for i := 1; i < len(bars); i++ {
+		prev := bars[i-1].Close
+		b := bars[i]
+		tr := math.Max(b.High-b.Low, math.Max(math.Abs(b.High-prev), math.Abs(b.Low-prev)))
+
+		switch {
+		case i < period:
+			atr += tr
+		case i == period:
+			atr = (atr + tr) / float64(period)
+		default:
+			atr = (atr*float64(period-1) + tr) / float64(period)
+		}
+	}
+	return atr, nil
+}
+
+// ATR returns the average true range of a symbol's completed daily bars,
+// fetched from TWS once a day
+func (m *IBManager) ATR(symbol string) (float64, error) {
+	today := time.Now().Format("20060102")
+
+	m.mu.Lock()
+	cached, ok := m.atrs[symbol]
+	m.mu.Unlock()
+	if ok && cached.day == today {
+		return cached.value, nil
+	}
+
+	contract, err := m.resolveContract(symbol)
+	if err != nil {
+		return 0, err
+	}
+	bars, err := m.dailyBars(contract)
+	if err != nil {
+		return 0, err
+	}
+
+	// leave out today's bar, which is still forming
+	if n := len(bars); n > 0 && bars[n-1].Date.Format("20060102") == today {
+		bars = bars[:n-1]
+	}
+	atr, err := averageTrueRange(bars, atrPeriod)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s: %v", m.label, symbol, err)
+	}
+
+	m.mu.Lock()
+	if m.atrs == nil {
+		m.atrs = make(map[string]atrValue)
+	}
+	m.atrs[symbol] = atrValue{value: atr, day: today}
+	m.mu.Unlock()
+
+	log.Printf("%s: ATR(%d) of %s is %.4f", m.label, atrPeriod, symbol, atr)
+	return atr, nil
+}
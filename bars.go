@@ -0,0 +1,84 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"github.com/gofinance/ib"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBars is how many realtime bars are kept per symbol, a full day of 5 second bars
+const maxBars = 24 * 60 * 12
+
+// Bar is one price bar
+type Bar struct {
+	Time  time.Time
+	Open  float64
+	High  float64
+	Low   float64
+	Close float64
+}
+
+// barStore keeps the realtime bars received this session by symbol
+type barStore struct {
+	mu   sync.Mutex
+	bars map[string][]Bar
+}
+
+func newBarStore() *barStore {
+	return &barStore{bars: make(map[string][]Bar)}
+}
+
+func (s *barStore) add(symbol string, r *ib.RealtimeBars) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	symbol = strings.ToUpper(symbol)
+	bars := append(s.bars[symbol], Bar{
+		Time:  time.Unix(r.Time, 0),
+		Open:  r.Open,
+		High:  r.High,
+		Low:   r.Low,
+		Close: r.Close,
+	})
+	if len(bars) > maxBars {
+		bars = bars[len(bars)-maxBars:]
+	}
+	s.bars[symbol] = bars
+}
+
+// between returns the bars for the first symbol that has any in [from, to]
+func (s *barStore) between(symbols []string, from time.Time, to time.Time) []Bar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, symbol := range symbols {
+		var list []Bar
+		for _, b := range s.bars[strings.ToUpper(symbol)] {
+			if !b.Time.Before(from) && !b.Time.After(to) {
+				list = append(list, b)
+			}
+		}
+		if len(list) > 0 {
+			return list
+		}
+	}
+	return nil
+}
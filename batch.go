@@ -0,0 +1,129 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ackTimeout is how long batch mode waits for TWS to answer an order
+const ackTimeout = 10 * time.Second
+
+// expectAck registers an order id whose OrderStatus or error batch mode waits for
+func (m *IBManager) expectAck(id int64) {
+	w := m.expect(orderReply(id), isOrderStatus, false)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acks = append(m.acks, w)
+}
+
+// awaitAcks waits until every expected order has been answered
+func (m *IBManager) awaitAcks(timeout time.Duration) error {
+	m.mu.Lock()
+	acks := m.acks
+	m.acks = nil
+	m.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	var first error
+	for _, w := range acks {
+		_, err := m.wait(w, deadline.Sub(time.Now()))
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// isOrderError tells errors that reject an order from warnings and notices
+func isOrderError(code int64) bool {
+	switch {
+	case code == 399: // order message warning
+		return false
+	case code >= 2100 && code < 2200:
+		return false
+	}
+	return true
+}
+
+// readBatch splits a script into commands, one per line or separated by ';'
+func readBatch(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		for _, line := range strings.Split(scanner.Text(), ";") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func readBatchFile(filename string) ([]string, error) {
+	if filename == "-" {
+		return readBatch(os.Stdin)
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readBatch(file)
+}
+
+// runBatch executes the commands in order, waiting for TWS to answer every
+// order before moving on.  It stops at the first command that fails.
+func (s *session) runBatch(lines []string) error {
+	for _, ac := range s.accts {
+		ac.trackAcks = true
+		ac.confirm = func(question string) bool {
+			fmt.Fprintf(os.Stderr, "%s: confirmation is not possible in batch mode, set SkipConfirm\n", question)
+			return false
+		}
+	}
+
+	for _, line := range lines {
+		log.Printf("BATCH: %s", line)
+		err := s.execute(line)
+		for _, ac := range s.accts {
+			if aerr := ac.awaitAcks(ackTimeout); aerr != nil && err == nil {
+				err = aerr
+			}
+		}
+		if err != nil {
+			log.Printf("BATCH: '%s' failed: %v", line, err)
+			return err
+		}
+		if s.quit {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Command fakegw runs the fake gateway so ibstockcli can be pointed at it from config.js
+package main
+
+import (
+	"flag"
+	"github.com/dsouzae/ibstockcli/fakegw"
+	"log"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:4001", "address to listen on")
+	nextid := flag.Int64("nextid", 1, "first order id handed to clients")
+	account := flag.String("account", "DU000000", "account code reported to clients")
+	netliq := flag.String("netliq", "100000.00", "NetLiquidation reported in account summaries")
+	funds := flag.String("funds", "50000.00", "AvailableFunds reported in account summaries")
+	flag.Parse()
+
+	s, err := fakegw.NewServer(*listen)
+	if err != nil {
+		log.Fatalf("fakegw: %v", err)
+	}
+	s.Account = *account
+	s.Summary["NetLiquidation"] = *netliq
+	s.Summary["AvailableFunds"] = *funds
+	s.SetNextValidID(*nextid)
+	log.Printf("fakegw: listening on %s", s.Addr())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+	s.Close()
+}
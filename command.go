@@ -0,0 +1,470 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// argKind describes how a command argument is parsed
+type argKind int
+
+const (
+	argString argKind = iota
+	argSymbol
+	argQuantity
+	argPrice
+	argOffset
+	argOrderID
+	argToggle
+	argRisk
+	// argEntry is a price, or mkt for a market order
+	argEntry
+)
+
+// allOrders is the argOrderID value for "all"
+const allOrders int64 = -1
+
+type cmdArg struct {
+	name     string
+	kind     argKind
+	optional bool
+	// rest collects this and every following word
+	rest bool
+}
+
+// cmdArgs holds the parsed values of a command line in declaration order
+type cmdArgs struct {
+	strs   []string
+	values []interface{}
+}
+
+func (a cmdArgs) has(i int) bool {
+	return i < len(a.strs)
+}
+
+func (a cmdArgs) str(i int) string {
+	return a.strs[i]
+}
+
+func (a cmdArgs) rest(i int) []string {
+	return a.strs[i:]
+}
+
+func (a cmdArgs) symbol(i int) string {
+	return a.values[i].(string)
+}
+
+func (a cmdArgs) quantity(i int) uint64 {
+	return a.values[i].(uint64)
+}
+
+func (a cmdArgs) price(i int) float64 {
+	return a.values[i].(float64)
+}
+
+func (a cmdArgs) offset(i int) priceOffset {
+	return a.values[i].(priceOffset)
+}
+
+func (a cmdArgs) orderID(i int) int64 {
+	return a.values[i].(int64)
+}
+
+func (a cmdArgs) toggle(i int) bool {
+	return a.values[i].(bool)
+}
+
+func (a cmdArgs) risk(i int) riskAmount {
+	return a.values[i].(riskAmount)
+}
+
+type command struct {
+	name    string
+	aliases []string
+	args    []cmdArg
+	help    string
+
+	// check validates the arguments against each other once parsed
+	check func(a cmdArgs) error
+
+	// apply runs once for every selected account
+	apply func(ac *IBManager, a cmdArgs) error
+	// all lets apply run on every account when none is selected
+	all bool
+	// order marks commands whose apply places orders
+	order bool
+
+	// run acts on the session itself rather than on accounts
+	run func(s *session, a cmdArgs) error
+
+	// repeat allows the same line to be entered twice in a row
+	repeat bool
+}
+
+func (c *command) usage() string {
+	parts := []string{c.name}
+	for _, arg := range c.args {
+		if arg.rest {
+			parts = append(parts, arg.name+" ...")
+		} else if arg.optional {
+			parts = append(parts, "["+arg.name+"]")
+		} else {
+			parts = append(parts, "<"+arg.name+">")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// tickSize is the minimum US equity price increment for a price
+func tickSize(price float64) float64 {
+	if price < 1.0 {
+		return 0.0001
+	}
+	return 0.01
+}
+
+// roundPrice rounds a computed price to the tick size when the contract trades in cents
+func roundPrice(c ib.Contract, price float64) float64 {
+	if !usesCentTicks(c) {
+		return price
+	}
+	return roundToTick(price, tickSize(price))
+}
+
+// roundToTick rounds to a multiple of tick, dividing by the whole number of
+// ticks in a dollar to keep 0.0001 ticks free of float noise
+func roundToTick(val float64, tick float64) float64 {
+	return math.Round(val/tick) / math.Round(1/tick)
+}
+
+// offsetTick is the tick size for a distance from refprice, the cent when
+// refprice is not known
+func offsetTick(refprice float64) float64 {
+	if refprice <= 0 {
+		return 0.01
+	}
+	return tickSize(refprice)
+}
+
+func checkTick(price float64) error {
+	return checkTickSize(price, tickSize(price))
+}
+
+func checkTickSize(price float64, tick float64) error {
+	steps := price / tick
+	if math.Abs(steps-math.Round(steps)) > 1e-6 {
+		return fmt.Errorf("not a multiple of the %v tick size", tick)
+	}
+	return nil
+}
+
+// checkTicks applies the US equity tick size to the prices of commands on US stocks
+func (c *command) checkTicks(a cmdArgs) error {
+	cents := false
+	for i, arg := range c.args {
+		if arg.kind == argSymbol && i < len(a.values) {
+			contract, _ := ParseContract(a.symbol(i))
+			cents = usesCentTicks(contract)
+		}
+	}
+	if !cents {
+		return nil
+	}
+
+	// dollar offsets are distances from the first price given
+	refprice := 0.0
+	for i, arg := range c.args {
+		if i < len(a.values) && (arg.kind == argPrice || arg.kind == argEntry) && a.price(i) > 0 {
+			refprice = a.price(i)
+			break
+		}
+	}
+
+	for i, arg := range c.args {
+		if i >= len(a.values) {
+			break
+		}
+		var err error
+		switch arg.kind {
+		case argPrice, argEntry:
+			err = checkTick(a.price(i))
+		case argOffset:
+			if a.offset(i).unit != unitDollars {
+				continue
+			}
+			err = checkTickSize(a.offset(i).value, offsetTick(refprice))
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': %v\nusage: %s", arg.name, a.str(i), err, c.usage())
+		}
+	}
+	return nil
+}
+
+func parseArg(arg cmdArg, str string) (interface{}, error) {
+	switch arg.kind {
+	case argSymbol:
+		symbol := strings.ToUpper(str)
+		if _, err := ParseContract(symbol); err != nil {
+			return nil, err
+		}
+		return symbol, nil
+
+	case argQuantity:
+		quantity, err := strconv.ParseUint(str, 10, 64)
+		if err != nil || quantity == 0 {
+			return nil, fmt.Errorf("not a positive whole number")
+		}
+		return quantity, nil
+
+	case argPrice:
+		price, err := strconv.ParseFloat(str, 64)
+		if err != nil || math.IsNaN(price) || math.IsInf(price, 0) {
+			return nil, fmt.Errorf("not a number")
+		}
+		if price <= 0 {
+			return nil, fmt.Errorf("must be greater than zero")
+		}
+		return price, nil
+
+	case argOffset:
+		return parseOffset(str)
+
+	case argEntry:
+		if strings.EqualFold(str, "mkt") {
+			return 0.0, nil
+		}
+		return parseArg(cmdArg{name: arg.name, kind: argPrice}, str)
+
+	case argOrderID:
+		if str == "all" {
+			return allOrders, nil
+		}
+		id, err := strconv.ParseInt(str, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("not an order id")
+		}
+		return id, nil
+
+	case argToggle:
+		switch str {
+		case "on":
+			return true, nil
+		case "off":
+			return false, nil
+		}
+		return nil, fmt.Errorf("expected on or off")
+
+	case argRisk:
+		return parseRisk(str)
+	}
+	return str, nil
+}
+
+func (c *command) parse(strs []string) (cmdArgs, error) {
+	required := 0
+	for _, arg := range c.args {
+		if !arg.optional {
+			required++
+		}
+	}
+	rest := len(c.args) > 0 && c.args[len(c.args)-1].rest
+	if len(strs) < required || (len(strs) > len(c.args) && !rest) {
+		return cmdArgs{}, fmt.Errorf("usage: %s", c.usage())
+	}
+
+	a := cmdArgs{strs: strs}
+	for i, str := range strs {
+		if i >= len(c.args) {
+			a.values = append(a.values, str)
+			continue
+		}
+		val, err := parseArg(c.args[i], str)
+		if err != nil {
+			return cmdArgs{}, fmt.Errorf("invalid %s '%s': %v\nusage: %s", c.args[i].name, str, err, c.usage())
+		}
+		a.values = append(a.values, val)
+	}
+
+	if err := c.checkTicks(a); err != nil {
+		return cmdArgs{}, err
+	}
+
+	if c.check != nil {
+		if err := c.check(a); err != nil {
+			return cmdArgs{}, err
+		}
+	}
+	return a, nil
+}
+
+// The registry maps command names and aliases to their definitions
+type registry struct {
+	cmds   []*command
+	lookup map[string]*command
+}
+
+func newRegistry() *registry {
+	return &registry{lookup: make(map[string]*command)}
+}
+
+func (r *registry) add(c *command) {
+	r.cmds = append(r.cmds, c)
+	r.lookup[c.name] = c
+	for _, alias := range c.aliases {
+		r.lookup[alias] = c
+	}
+}
+
+func (r *registry) find(name string) *command {
+	return r.lookup[name]
+}
+
+// names returns every command name and alias in sorted order
+func (r *registry) names() []string {
+	var names []string
+	for name := range r.lookup {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type session struct {
+	cmds       *registry
+	accts      []*IBManager
+	acctselect string
+	out        *printer
+	lastresult string
+	quit       bool
+}
+
+func newSession(accts []*IBManager, out *printer, presets []Preset) (*session, error) {
+	s := &session{
+		accts: accts,
+		out:   out,
+	}
+	s.cmds = newCommands()
+	if err := s.cmds.addPresets(presets); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// prompt shows the selected account and every account that is not connected
+func (s *session) prompt() string {
+	p := s.acctselect
+	var down []string
+	for _, ac := range s.accts {
+		if state := ac.connState(); state != connUp {
+			down = append(down, ac.label+":"+state.String())
+		}
+	}
+	if len(down) > 0 {
+		p = strings.TrimSpace(p + " [" + strings.Join(down, " ") + "]")
+	}
+	if p == "" {
+		return "> "
+	}
+	return p + " > "
+}
+
+// account finds an account by label
+func (s *session) account(label string) (*IBManager, error) {
+	for _, ac := range s.accts {
+		if ac.label == label {
+			return ac, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown account '%s'", label)
+}
+
+// selected returns the accounts commands currently apply to
+func (s *session) selected() []*IBManager {
+	var accts []*IBManager
+	for _, ac := range s.accts {
+		if s.acctselect == "" || ac.label == s.acctselect {
+			accts = append(accts, ac)
+		}
+	}
+	return accts
+}
+
+func (s *session) execute(line string) error {
+	strs := strings.Fields(line)
+	if len(strs) == 0 {
+		return nil
+	}
+
+	c := s.cmds.find(strs[0])
+	if c == nil {
+		return fmt.Errorf("unknown command %s", strs[0])
+	}
+
+	if c.repeat {
+		s.lastresult = ""
+	}
+
+	a, err := c.parse(strs[1:])
+	if err != nil {
+		return err
+	}
+
+	if c.run != nil {
+		return c.run(s, a)
+	}
+
+	return applyFunc(c.all, s.acctselect, s.accts, func(ac *IBManager) error {
+		if c.order {
+			if err := ac.orderable(); err != nil {
+				return err
+			}
+		}
+		return c.apply(ac, a)
+	})
+}
+
+// complete offers command names for the first word and account labels after it
+func (s *session) complete(text string, start, end int) []string {
+	var candidates []string
+	if start == 0 {
+		candidates = s.cmds.names()
+	} else {
+		candidates = append(candidates, "all", "on", "off")
+		for _, ac := range s.accts {
+			candidates = append(candidates, ac.label)
+		}
+		candidates = append(candidates, s.cmds.names()...)
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, text) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,903 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	symbolArg     = cmdArg{name: "symbol", kind: argSymbol}
+	quantityArg   = cmdArg{name: "quantity", kind: argQuantity}
+	toggleArg     = cmdArg{name: "on|off", kind: argToggle, optional: true}
+	limitpriceArg = cmdArg{name: "limitprice", kind: argPrice}
+	trailArg      = cmdArg{name: "trailamount", kind: argOffset}
+)
+
+func priceArg(name string) cmdArg {
+	return cmdArg{name: name, kind: argPrice}
+}
+
+func offsetArg(name string) cmdArg {
+	return cmdArg{name: name, kind: argOffset}
+}
+
+// checkTarget makes sure the target is on the profitable side of the entry
+func checkTarget(dir direction, entryprice float64, targetprice float64) error {
+	if dir == dirShort {
+		if targetprice >= entryprice {
+			return fmt.Errorf("buyprice %.4g must be below sellprice %.4g", targetprice, entryprice)
+		}
+		return nil
+	}
+	if targetprice <= entryprice {
+		return fmt.Errorf("sellprice %.4g must be above buyprice %.4g", targetprice, entryprice)
+	}
+	return nil
+}
+
+// checkBracket makes sure the stop and target sit on the right sides of the
+// entry, or of each other when the entry price is 0 for a market order
+func checkBracket(dir direction, entryprice float64, targetprice float64, stopprice float64) error {
+	if dir == dirShort {
+		if entryprice == 0 {
+			if stopprice <= targetprice {
+				return fmt.Errorf("stopprice %.4g must be above buyprice %.4g", stopprice, targetprice)
+			}
+		} else {
+			if err := checkTarget(dir, entryprice, targetprice); err != nil {
+				return err
+			}
+			if stopprice <= entryprice {
+				return fmt.Errorf("stopprice %.4g must be above sellprice %.4g", stopprice, entryprice)
+			}
+		}
+		// an offset larger than the entry buys back below zero
+		if targetprice <= 0 {
+			return fmt.Errorf("buyprice %.4g must be greater than zero", targetprice)
+		}
+		return nil
+	}
+
+	if entryprice == 0 {
+		if stopprice >= targetprice {
+			return fmt.Errorf("stopprice %.4g must be below sellprice %.4g", stopprice, targetprice)
+		}
+	} else {
+		if err := checkTarget(dir, entryprice, targetprice); err != nil {
+			return err
+		}
+		if stopprice >= entryprice {
+			return fmt.Errorf("stopprice %.4g must be below buyprice %.4g", stopprice, entryprice)
+		}
+	}
+	if stopprice <= 0 {
+		return fmt.Errorf("stopprice %.4g must be greater than zero", stopprice)
+	}
+	return nil
+}
+
+// bracketCommand builds a bracket command with the entry, target and stop prices given
+func bracketCommand(name string, dir direction, help string) *command {
+	return &command{
+		name: name,
+		args: []cmdArg{symbolArg, quantityArg, priceArg(strings.ToLower(dir.opening()) + "price"), priceArg(strings.ToLower(dir.closing()) + "price"), priceArg("stopprice")},
+		help: help,
+		check: func(a cmdArgs) error {
+			return checkBracket(dir, a.price(2), a.price(3), a.price(4))
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doBracket(ac, a.symbol(0), a.quantity(1), dir, a.price(2), a.price(3), a.price(4))
+		},
+	}
+}
+
+// offsetBracketCommand builds a bracket command with the target and stop given
+// as offsets from the entry price
+func offsetBracketCommand(name string, dir direction, help string) *command {
+	return &command{
+		name: name,
+		args: []cmdArg{symbolArg, quantityArg, priceArg(strings.ToLower(dir.opening()) + "price"), offsetArg(strings.ToLower(dir.closing()) + "off"), offsetArg("stopoff")},
+		help: help,
+		check: func(a cmdArgs) error {
+			if needsATR(a.offset(3), a.offset(4)) {
+				return nil
+			}
+			targetprice, stopprice := bracketPrices(a.symbol(0), dir, a.price(2), a.offset(3), a.offset(4), 0)
+			return checkBracket(dir, a.price(2), targetprice, stopprice)
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			atr, err := ac.atrFor(a.symbol(0), a.offset(3), a.offset(4))
+			if err != nil {
+				return err
+			}
+			targetprice, stopprice := bracketPrices(a.symbol(0), dir, a.price(2), a.offset(3), a.offset(4), atr)
+			if err := checkBracket(dir, a.price(2), targetprice, stopprice); err != nil {
+				return err
+			}
+			return doBracket(ac, a.symbol(0), a.quantity(1), dir, a.price(2), targetprice, stopprice)
+		},
+	}
+}
+
+// stopBracketCommand builds a bracket command whose stop is a TRAIL, TRAIL LIMIT
+// or STP LMT order, entering at a limit price or at market
+func stopBracketCommand(name string, dir direction, stopType string, help string) *command {
+	args := []cmdArg{symbolArg, quantityArg,
+		{name: strings.ToLower(dir.opening()) + "price|mkt", kind: argEntry},
+		priceArg(strings.ToLower(dir.closing()) + "price")}
+	switch stopType {
+	case "TRAIL":
+		args = append(args, trailArg)
+	case "TRAIL LIMIT":
+		args = append(args, priceArg("stopprice"), trailArg, offsetArg("limitoffset"))
+	case "STP LMT":
+		args = append(args, priceArg("stopprice"), offsetArg("limitoffset"))
+	}
+
+	return &command{
+		name: name,
+		args: args,
+		help: help,
+		check: func(a cmdArgs) error {
+			if stopType == "TRAIL" {
+				if a.price(2) != 0 {
+					if err := checkTarget(dir, a.price(2), a.price(3)); err != nil {
+						return err
+					}
+				}
+				return checkTrail(a.offset(4))
+			}
+			if err := checkBracket(dir, a.price(2), a.price(3), a.price(4)); err != nil {
+				return err
+			}
+			limitoffset := a.offset(5)
+			if stopType == "TRAIL LIMIT" {
+				if err := checkTrail(a.offset(5)); err != nil {
+					return err
+				}
+				limitoffset = a.offset(6)
+			}
+			if needsATR(limitoffset) {
+				return nil
+			}
+			return checkStopLimit(roundTick(a.symbol(0), a.price(4)-dir.sign()*limitoffset.dollars(a.price(4), 0)))
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			symbol := a.symbol(0)
+			b := bracketOrder{
+				Direction:  dir,
+				Entry:      a.price(2),
+				EntryType:  "LMT",
+				Target:     a.price(3),
+				TargetType: "LMT",
+				StopType:   stopType,
+			}
+			if b.Entry == 0 {
+				b.EntryType = "MKT"
+			}
+
+			var err error
+			switch stopType {
+			case "TRAIL":
+				refprice := b.Entry
+				if refprice == 0 {
+					refprice = b.Target
+				}
+				b.Trail, err = ac.resolveTrail(symbol, a.offset(4), refprice)
+			case "TRAIL LIMIT":
+				var trailamount, limitoffset float64
+				b.Stop = a.price(4)
+				trailamount, limitoffset, err = ac.stopOffsets(symbol, b.Stop, a.offset(5), a.offset(6))
+				b.Trail = priceOffset{value: trailamount}
+				b.StopLimit = roundTick(symbol, b.Stop-dir.sign()*limitoffset)
+			case "STP LMT":
+				var limitoffset float64
+				b.Stop = a.price(4)
+				_, limitoffset, err = ac.stopOffsets(symbol, b.Stop, priceOffset{}, a.offset(5))
+				b.StopLimit = roundTick(symbol, b.Stop-dir.sign()*limitoffset)
+			}
+			if err != nil {
+				return err
+			}
+			if stopType != "TRAIL" {
+				if err := checkStopLimit(b.StopLimit); err != nil {
+					return err
+				}
+			}
+			return placeBracket(ac, symbol, a.quantity(1), b)
+		},
+	}
+}
+
+// checkStopLimit refuses a limitoffset that takes the limit of a stop to zero or below
+func checkStopLimit(stoplimit float64) error {
+	if stoplimit <= 0 {
+		return fmt.Errorf("stop limit price %.4g must be greater than zero", stoplimit)
+	}
+	return nil
+}
+
+// checkTrail refuses a trailing amount of nothing
+func checkTrail(trail priceOffset) error {
+	if trail.zero() {
+		return fmt.Errorf("trailamount must be greater than zero")
+	}
+	return nil
+}
+
+// toggleCommand builds a command that shows or switches an on/off setting
+func toggleCommand(name string, help string, setting func(*Settings) *bool) *command {
+	return &command{
+		name: name,
+		args: []cmdArg{toggleArg},
+		help: help,
+		all:  true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			ac.mu.Lock()
+			value := setting(&ac.settings)
+			if a.has(0) {
+				*value = a.toggle(0)
+			}
+			status := *value
+			ac.mu.Unlock()
+
+			if ac.out.Format() == formatJSON {
+				ac.out.json("toggle", ac.label, map[string]interface{}{"Name": name, "Status": status})
+				return nil
+			}
+			fmt.Printf("%s: %s status %v\n", ac.label, name, status)
+			return nil
+		},
+	}
+}
+
+func newCommands() *registry {
+	r := newRegistry()
+
+	r.add(&command{
+		name:    "exit",
+		aliases: []string{"quit"},
+		help:    "leave ibstockcli",
+		run: func(s *session, a cmdArgs) error {
+			s.quit = true
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "help",
+		args:   []cmdArg{{name: "command", kind: argString, optional: true}},
+		help:   "list commands, or describe one command",
+		repeat: true,
+		run: func(s *session, a cmdArgs) error {
+			if a.has(0) {
+				c := s.cmds.find(a.str(0))
+				if c == nil {
+					return fmt.Errorf("unknown command %s", a.str(0))
+				}
+				fmt.Printf("%s\n    %s\n", c.usage(), c.help)
+				return nil
+			}
+			for _, c := range s.cmds.cmds {
+				fmt.Printf("%-60s %s\n", c.usage(), c.help)
+			}
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "select",
+		args:   []cmdArg{{name: "label|all", kind: argString}},
+		help:   "choose the account commands apply to",
+		repeat: true,
+		run: func(s *session, a cmdArgs) error {
+			if a.str(0) == "all" {
+				s.acctselect = ""
+				return nil
+			}
+			for _, ac := range s.accts {
+				if ac.label == a.str(0) {
+					s.acctselect = ac.label
+					break
+				}
+			}
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name: "connect",
+		args: []cmdArg{{name: "label", kind: argString}},
+		help: "connect an account to its gateway",
+		run: func(s *session, a cmdArgs) error {
+			ac, err := s.account(a.str(0))
+			if err != nil {
+				return err
+			}
+			if err := ac.start(); err != nil {
+				log.Printf("%s: not connected: %v", ac.label, err)
+				return err
+			}
+			log.Printf("%s: connected", ac.label)
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name: "disconnect",
+		args: []cmdArg{{name: "label", kind: argString}},
+		help: "disconnect an account, it stays down until connect",
+		run: func(s *session, a cmdArgs) error {
+			ac, err := s.account(a.str(0))
+			if err != nil {
+				return err
+			}
+			ac.stop()
+			log.Printf("%s: disconnected", ac.label)
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name: "format",
+		args: []cmdArg{{name: "json|table|text", kind: argString, optional: true}},
+		help: "choose how results are printed",
+		check: func(a cmdArgs) error {
+			if a.has(0) {
+				_, err := parseFormat(a.str(0))
+				return err
+			}
+			return nil
+		},
+		run: func(s *session, a cmdArgs) error {
+			if a.has(0) {
+				format, _ := parseFormat(a.str(0))
+				s.out.SetFormat(format)
+			}
+			log.Printf("format %v", s.out.Format())
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "summary",
+		help:   "request the account summary",
+		all:    true,
+		repeat: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			summary, err := ac.AccountSummary("BuyingPower,NetLiquidation,GrossPositionValue,TotalCashValue,SettledCash,InitMarginReq,MaintMarginReq,AvailableFunds,TotalCashValue,UnrealizedPnL")
+			if err != nil {
+				return err
+			}
+			var recs []record
+			for _, r := range summary {
+				recs = append(recs, newSummaryRecord(r))
+			}
+			ac.out.print(ac.label, recs...)
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "open",
+		help:   "request open orders",
+		all:    true,
+		repeat: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			orders, err := ac.OpenOrders()
+			if err != nil {
+				return err
+			}
+			var recs []record
+			for _, r := range orders {
+				recs = append(recs, newOpenOrderRecord(r))
+			}
+			ac.out.print(ac.label, recs...)
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "orders",
+		args:   []cmdArg{{name: "working", kind: argString, optional: true}},
+		help:   "show the orders tracked this session, or only the working ones",
+		repeat: true,
+		run: func(s *session, a cmdArgs) error {
+			if a.has(0) && a.str(0) != "working" {
+				return fmt.Errorf("usage: orders [working]")
+			}
+			printOrders(s.out, s.selected(), a.has(0))
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "positions",
+		help:   "request positions",
+		all:    true,
+		repeat: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			positions, err := ac.Positions()
+			if err != nil {
+				return err
+			}
+			var recs []record
+			for _, r := range positions {
+				recs = append(recs, newPositionRecord(r))
+			}
+			ac.out.print(ac.label, recs...)
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "pos",
+		help:   "show positions and PnL kept from TWS updates, combined across accounts",
+		repeat: true,
+		run: func(s *session, a cmdArgs) error {
+			printPositions(s.out, s.selected())
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "updates",
+		help:   "subscribe to account updates",
+		all:    true,
+		repeat: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			req := &ib.RequestAccountUpdates{}
+			req.Subscribe = true
+			ac.setAccountUpdates(true)
+			return ac.send(req)
+		},
+	})
+
+	r.add(&command{
+		name: "noupdates",
+		help: "unsubscribe from account updates",
+		all:  true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			req := &ib.RequestAccountUpdates{}
+			req.Subscribe = false
+			ac.setAccountUpdates(false)
+			return ac.send(req)
+		},
+	})
+
+	r.add(&command{
+		name: "elog",
+		args: []cmdArg{
+			{name: "export", kind: argString, optional: true},
+			{name: "file", kind: argString, optional: true},
+			{name: "csv|json|ofx", kind: argString, optional: true},
+		},
+		help:   "request today's executions, or export them to a file",
+		repeat: true,
+		check: func(a cmdArgs) error {
+			if !a.has(0) {
+				return nil
+			}
+			if a.str(0) != "export" || !a.has(1) {
+				return fmt.Errorf("usage: elog [export <file> [csv|json|ofx]]")
+			}
+			if a.has(2) {
+				return checkExportFormat(a.str(2))
+			}
+			return nil
+		},
+		run: func(s *session, a cmdArgs) error {
+			export := a.has(0)
+			var rows []exportRow
+			var failed []string
+			err := applyFunc(true, s.acctselect, s.accts, func(ac *IBManager) error {
+				executions, err := ac.Executions()
+				if err != nil {
+					failed = append(failed, ac.label)
+					return err
+				}
+				var recs []record
+				for _, x := range executions {
+					rec := newExecutionRecord(x)
+					recs = append(recs, rec)
+					rows = append(rows, exportRow{ac.label, rec})
+				}
+				if !export {
+					ac.out.print(ac.label, recs...)
+				}
+				return nil
+			})
+			if !export {
+				return err
+			}
+			// still write what the other accounts returned
+			if len(failed) > 0 && len(failed) == len(s.selected()) {
+				return err
+			}
+
+			format := "csv"
+			if a.has(2) {
+				format = a.str(2)
+			}
+			if err := exportExecutions(a.str(1), format, rows); err != nil {
+				log.Printf("ERROR exporting executions: %v", err)
+				return err
+			}
+			log.Printf("ELOG: wrote %d executions to %s", len(rows), a.str(1))
+			if len(failed) > 0 {
+				return fmt.Errorf("executions of %s are missing from %s", strings.Join(failed, ", "), a.str(1))
+			}
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name: "history",
+		args: []cmdArg{{name: "symbol|from|to", kind: argString, optional: true, rest: true}},
+		help: "show stored executions, dates as YYYY-MM-DD",
+		check: func(a cmdArgs) error {
+			_, _, _, err := parseHistoryArgs(a.rest(0))
+			return err
+		},
+		run: func(s *session, a cmdArgs) error {
+			if len(s.accts) == 0 {
+				return nil
+			}
+			symbol, from, to, _ := parseHistoryArgs(a.rest(0))
+			labels := make(map[string]bool)
+			for _, ac := range s.selected() {
+				labels[ac.label] = true
+			}
+
+			entries := s.accts[0].history.query(labels, strings.ToUpper(symbol), from, to)
+			// one block per account, each still in time order
+			sort.SliceStable(entries, func(i, j int) bool { return entries[i].Label < entries[j].Label })
+			for i := 0; i < len(entries); {
+				label := entries[i].Label
+				var recs []record
+				for ; i < len(entries) && entries[i].Label == label; i++ {
+					recs = append(recs, historyRecord{newExecutionRecord(&entries[i].Execution)})
+				}
+				s.out.print(label, recs...)
+			}
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name: "trades",
+		args: []cmdArg{{name: "fifo|lifo|average|symbol|from|to", kind: argString, optional: true, rest: true}},
+		help: "match stored executions into trades with PnL, by day and symbol",
+		check: func(a cmdArgs) error {
+			_, _, _, _, err := parseTradesArgs(a.rest(0))
+			return err
+		},
+		run: func(s *session, a cmdArgs) error {
+			if len(s.accts) == 0 {
+				return nil
+			}
+			method, symbol, from, to, _ := parseTradesArgs(a.rest(0))
+			symbol = strings.ToUpper(symbol)
+			labels := make(map[string]bool)
+			for _, ac := range s.selected() {
+				labels[ac.label] = true
+			}
+
+			// match over the whole history so positions opened earlier are known
+			entries := s.accts[0].history.query(labels, "", time.Time{}, time.Time{})
+			var trades []Trade
+			for _, t := range matchTrades(entries, method, s.accts[0].bars) {
+				if symbol != "" && t.Symbol != symbol {
+					continue
+				}
+				if (!from.IsZero() && t.ExitTime.Before(from)) || (!to.IsZero() && !t.ExitTime.Before(to)) {
+					continue
+				}
+				trades = append(trades, t)
+			}
+
+			// one block per account, each still in exit time order
+			sort.SliceStable(trades, func(i, j int) bool { return trades[i].Label < trades[j].Label })
+			for i := 0; i < len(trades); {
+				label := trades[i].Label
+				var recs []record
+				for ; i < len(trades) && trades[i].Label == label; i++ {
+					recs = append(recs, tradeRecord{trades[i]})
+				}
+				s.out.print(label, recs...)
+			}
+
+			label := s.acctselect
+			if label == "" {
+				label = "all"
+			}
+			var recs []record
+			for _, sum := range summarize(trades, func(t Trade) string { return t.ExitTime.Format("2006-01-02") }) {
+				recs = append(recs, tradeSummaryRecord{sum, "day"})
+			}
+			s.out.print(label, recs...)
+			recs = nil
+			for _, sum := range summarize(trades, func(t Trade) string { return t.Symbol }) {
+				recs = append(recs, tradeSummaryRecord{sum, "symbol"})
+			}
+			s.out.print(label, recs...)
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name:   "whatif",
+		args:   []cmdArg{{name: "order command", kind: argString, rest: true}},
+		help:   "show margin and commission for an order without transmitting it",
+		repeat: true,
+		run: func(s *session, a cmdArgs) error {
+			inner := s.cmds.find(a.str(0))
+			if inner == nil || !inner.order {
+				return fmt.Errorf("whatif needs an order command, e.g. whatif buy-l AAPL 100 150")
+			}
+			ia, err := inner.parse(a.rest(1))
+			if err != nil {
+				return err
+			}
+			return applyFunc(false, s.acctselect, s.accts, func(ac *IBManager) error {
+				if err := ac.orderable(); err != nil {
+					return err
+				}
+				ac.whatif = true
+				defer func() { ac.whatif = false }()
+
+				err := inner.apply(ac, ia)
+				if err == errWhatIf {
+					return nil
+				}
+				return err
+			})
+		},
+	})
+
+	r.add(&command{
+		name: "sell-t",
+		args: []cmdArg{symbolArg, quantityArg, trailArg},
+		help: "sell with a trailing stop, trailing by dollars, percent (1.5%) or ATRs (2atr)",
+		check: func(a cmdArgs) error {
+			return checkTrail(a.offset(2))
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doSellTrail(ac, a.symbol(0), a.quantity(1), a.offset(2))
+		},
+	})
+
+	r.add(&command{
+		name: "sell-tl",
+		args: []cmdArg{symbolArg, quantityArg, priceArg("stopprice"), trailArg, offsetArg("limitoffset")},
+		help: "sell with a trailing stop limit, offsets in dollars, percent of the stop or ATRs",
+		check: func(a cmdArgs) error {
+			return checkTrail(a.offset(3))
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			trailamount, limitoffset, err := ac.stopOffsets(a.symbol(0), a.price(2), a.offset(3), a.offset(4))
+			if err != nil {
+				return err
+			}
+			return doSellTrailLimit(ac, a.symbol(0), a.quantity(1), trailamount, a.price(2), limitoffset)
+		},
+	})
+
+	r.add(&command{
+		name:  "sell-l",
+		args:  []cmdArg{symbolArg, quantityArg, limitpriceArg},
+		help:  "sell at a limit price",
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doSell(ac, a.symbol(0), a.quantity(1), false, a.price(2))
+		},
+	})
+
+	r.add(&command{
+		name:  "sell-m",
+		args:  []cmdArg{symbolArg, quantityArg},
+		help:  "sell at market",
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doSell(ac, a.symbol(0), a.quantity(1), true, 0)
+		},
+	})
+
+	r.add(&command{
+		name: "buy-t",
+		args: []cmdArg{symbolArg, quantityArg, trailArg},
+		help: "buy with a trailing stop, trailing by dollars, percent (1.5%) or ATRs (2atr)",
+		check: func(a cmdArgs) error {
+			return checkTrail(a.offset(2))
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doBuyTrail(ac, a.symbol(0), a.quantity(1), a.offset(2))
+		},
+	})
+
+	r.add(&command{
+		name:  "buy-if",
+		args:  []cmdArg{symbolArg, quantityArg, priceArg("trailamount")},
+		help:  "buy with a trailing market if touched",
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doBuyTrailMarketIfTouched(ac, a.symbol(0), a.quantity(1), a.price(2))
+		},
+	})
+
+	r.add(&command{
+		name: "buy-tl",
+		args: []cmdArg{symbolArg, quantityArg, priceArg("stopprice"), trailArg, offsetArg("limitoffset")},
+		help: "buy with a trailing stop limit, offsets in dollars, percent of the stop or ATRs",
+		check: func(a cmdArgs) error {
+			return checkTrail(a.offset(3))
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			trailamount, limitoffset, err := ac.stopOffsets(a.symbol(0), a.price(2), a.offset(3), a.offset(4))
+			if err != nil {
+				return err
+			}
+			return doBuyTrailLimit(ac, a.symbol(0), a.quantity(1), trailamount, a.price(2), limitoffset)
+		},
+	})
+
+	r.add(&command{
+		name:  "buy-l",
+		args:  []cmdArg{symbolArg, quantityArg, limitpriceArg},
+		help:  "buy at a limit price",
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doBuy(ac, a.symbol(0), a.quantity(1), false, a.price(2))
+		},
+	})
+
+	r.add(&command{
+		name:  "buy-m",
+		args:  []cmdArg{symbolArg, quantityArg},
+		help:  "buy at market",
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doBuy(ac, a.symbol(0), a.quantity(1), true, 0)
+		},
+	})
+
+	r.add(bracketCommand("bracket", dirLong, "buy limit with a profit target and a protective stop"))
+	r.add(offsetBracketCommand("brka", dirLong, "bracket with target and stop given as offsets from the buy price in dollars, percent (1.5%) or ATRs (2atr)"))
+	r.add(bracketCommand("sbracket", dirShort, "sell short at a limit with a buy profit target and a buy protective stop"))
+	r.add(offsetBracketCommand("sbrka", dirShort, "short bracket with target and stop given as offsets from the sell price in dollars, percent (1.5%) or ATRs (2atr)"))
+	r.add(stopBracketCommand("brk-t", dirLong, "TRAIL", "bracket whose stop trails by dollars, percent (1.5%) or ATRs (2atr), buying at a limit or mkt"))
+	r.add(stopBracketCommand("brk-tl", dirLong, "TRAIL LIMIT", "bracket whose stop is a trailing stop limit starting at stopprice, buying at a limit or mkt"))
+	r.add(stopBracketCommand("brk-sl", dirLong, "STP LMT", "bracket whose stop is a stop limit filling down to stopprice - limitoffset, buying at a limit or mkt"))
+	r.add(stopBracketCommand("sbrk-t", dirShort, "TRAIL", "short bracket whose stop trails by dollars, percent (1.5%) or ATRs (2atr), selling at a limit or mkt"))
+	r.add(stopBracketCommand("sbrk-tl", dirShort, "TRAIL LIMIT", "short bracket whose stop is a trailing stop limit starting at stopprice, selling at a limit or mkt"))
+	r.add(stopBracketCommand("sbrk-sl", dirShort, "STP LMT", "short bracket whose stop is a stop limit filling up to stopprice + limitoffset, selling at a limit or mkt"))
+
+	r.add(&command{
+		name: "brk-risk",
+		args: []cmdArg{symbolArg, {name: "risk$|risk%", kind: argRisk}, priceArg("buyprice"), priceArg("sellprice"), priceArg("stopprice")},
+		help: "bracket sized per account so the stop loses at most risk dollars or percent of NetLiquidation",
+		check: func(a cmdArgs) error {
+			return checkBracket(dirLong, a.price(2), a.price(3), a.price(4))
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			quantity, err := ac.riskQuantity(a.symbol(0), a.risk(1), a.price(2), a.price(4))
+			if err != nil {
+				return err
+			}
+			return doBracket(ac, a.symbol(0), quantity, dirLong, a.price(2), a.price(3), a.price(4))
+		},
+	})
+
+	r.add(&command{
+		name:  "stop-m",
+		args:  []cmdArg{symbolArg, quantityArg, priceArg("stopprice")},
+		help:  "sell with a stop market order",
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doStopMarket(ac, a.symbol(0), a.quantity(1), a.price(2))
+		},
+	})
+
+	r.add(toggleCommand("override", "show every account update value", func(s *Settings) *bool { return &s.UpdateOverride }))
+	r.add(toggleCommand("rth", "allow orders to fill outside regular trading hours", func(s *Settings) *bool { return &s.OutsideRTH }))
+	r.add(toggleCommand("gtc", "send orders good till cancelled instead of day", func(s *Settings) *bool { return &s.GTC }))
+	r.add(toggleCommand("acct-cancel", "cancel account summaries and updates once received", func(s *Settings) *bool { return &s.CancelAccount }))
+
+	r.add(&command{
+		name: "contract",
+		args: []cmdArg{symbolArg},
+		help: "show what TWS knows about a contract",
+		apply: func(ac *IBManager, a cmdArgs) error {
+			_, info, err := ac.lookupContract(a.symbol(0))
+			if err != nil {
+				return err
+			}
+			printContract(ac.out, ac.label, a.symbol(0), info)
+			return nil
+		},
+	})
+
+	r.add(&command{
+		name: "realtimebar",
+		args: []cmdArg{symbolArg},
+		help: "stream 5 second bars",
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return doRequestRealTimeBars(ac, a.symbol(0))
+		},
+	})
+
+	r.add(&command{
+		name:   "cancel",
+		args:   []cmdArg{{name: "orderid|all", kind: argOrderID}},
+		help:   "cancel an order, or every order",
+		all:    true,
+		repeat: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			if a.orderID(0) == allOrders {
+				return ac.send(&ib.RequestGlobalCancel{})
+			}
+			request := ib.CancelOrder{}
+			request.SetID(a.orderID(0))
+			return ac.send(&request)
+		},
+	})
+
+	r.add(&command{
+		name:  "modify",
+		args:  []cmdArg{{name: "orderid", kind: argOrderID}, {name: "qty=N lmt=P aux=P trail=P", kind: argString, rest: true}},
+		help:  "change a working order in place, bracket children follow the parent's quantity and limit",
+		order: true,
+		check: func(a cmdArgs) error {
+			if a.orderID(0) == allOrders {
+				return fmt.Errorf("modify needs a single order id")
+			}
+			_, err := parseChanges(a.rest(1))
+			return err
+		},
+		apply: func(ac *IBManager, a cmdArgs) error {
+			changes, _ := parseChanges(a.rest(1))
+			return doModify(ac, a.orderID(0), changes)
+		},
+	})
+
+	r.add(&command{
+		name:   "cancelall",
+		help:   "cancel every order",
+		all:    true,
+		repeat: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			return ac.send(&ib.RequestGlobalCancel{})
+		},
+	})
+
+	return r
+}
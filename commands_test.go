@@ -0,0 +1,118 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckBracket(t *testing.T) {
+	tests := []struct {
+		dir                 direction
+		entry, target, stop float64
+		ok                  bool
+	}{
+		{dirLong, 150, 160, 140, true},
+		{dirLong, 150, 140, 145, false},
+		{dirLong, 150, 160, 155, false},
+		{dirLong, 150, 160, 0, false},
+		// at market the stop only has to be below the target
+		{dirLong, 0, 160, 140, true},
+		{dirLong, 0, 160, 170, false},
+		{dirShort, 150, 140, 160, true},
+		{dirShort, 150, 160, 155, false},
+		{dirShort, 150, 140, 145, false},
+		{dirShort, 0, 140, 160, true},
+		{dirShort, 0, 160, 140, false},
+		// a short can't buy back at or below zero
+		{dirShort, 5, 0, 6, false},
+		{dirShort, 5, -5, 6, false},
+		{dirShort, 0, -5, 6, false},
+	}
+
+	for _, tt := range tests {
+		err := checkBracket(tt.dir, tt.entry, tt.target, tt.stop)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v %v/%v/%v: error %v, want ok %v", tt.dir, tt.entry, tt.target, tt.stop, err, tt.ok)
+		}
+	}
+}
+
+// TestOffsetBracket works out brackets from offsets and checks them, as the
+// offset bracket commands do
+func TestOffsetBracket(t *testing.T) {
+	tests := []struct {
+		dir          direction
+		entry        float64
+		target, stop priceOffset
+		atr          float64
+		wantTarget   float64
+		wantStop     float64
+		ok           bool
+	}{
+		{dirLong, 150, priceOffset{value: 0.20}, priceOffset{value: 0.05}, 0, 150.2, 149.95, true},
+		{dirLong, 150, priceOffset{value: 1, unit: unitPercent}, priceOffset{value: 0.5, unit: unitPercent}, 0, 151.5, 149.25, true},
+		{dirLong, 150, priceOffset{value: 2, unit: unitATR}, priceOffset{value: 1, unit: unitATR}, 1.5, 153, 148.5, true},
+		// a stop further away than the entry
+		{dirLong, 5, priceOffset{value: 1}, priceOffset{value: 10}, 0, 6, -5, false},
+		{dirShort, 150, priceOffset{value: 0.20}, priceOffset{value: 0.05}, 0, 149.8, 150.05, true},
+		{dirShort, 150, priceOffset{value: 2, unit: unitATR}, priceOffset{value: 1, unit: unitATR}, 1.5, 147, 151.5, true},
+		// sbrka X 100 5 10 1 would buy back at -5
+		{dirShort, 5, priceOffset{value: 10}, priceOffset{value: 1}, 0, -5, 6, false},
+		{dirShort, 5, priceOffset{value: 3, unit: unitATR}, priceOffset{value: 1, unit: unitATR}, 2, -1, 7, false},
+	}
+
+	for _, tt := range tests {
+		target, stop := bracketPrices("AAPL", tt.dir, tt.entry, tt.target, tt.stop, tt.atr)
+		if target != tt.wantTarget || stop != tt.wantStop {
+			t.Errorf("%v %v %s/%s: target %v stop %v, want %v %v", tt.dir, tt.entry, tt.target, tt.stop, target, stop, tt.wantTarget, tt.wantStop)
+		}
+		err := checkBracket(tt.dir, tt.entry, target, stop)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v %v %s/%s: error %v, want ok %v", tt.dir, tt.entry, tt.target, tt.stop, err, tt.ok)
+		}
+	}
+}
+
+// TestStopBracketLimit refuses a limitoffset that puts the limit of the stop at
+// or below zero
+func TestStopBracketLimit(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"brk-sl", "AAPL", "100", "150", "160", "140", "0.5"}, true},
+		{[]string{"brk-sl", "AAPL", "100", "mkt", "160", "140", "1%"}, true},
+		{[]string{"brk-sl", "AAPL", "100", "150", "160", "140", "150"}, false},
+		{[]string{"brk-sl", "AAPL", "100", "150", "160", "140", "140"}, false},
+		// ATR offsets are only known when the order is sent
+		{[]string{"brk-sl", "AAPL", "100", "150", "160", "140", "2atr"}, true},
+		{[]string{"brk-tl", "AAPL", "100", "150", "160", "140", "0.5", "0.5"}, true},
+		{[]string{"brk-tl", "AAPL", "100", "150", "160", "140", "0.5", "150"}, false},
+		{[]string{"sbrk-sl", "AAPL", "100", "150", "140", "160", "150"}, true},
+		{[]string{"brk-t", "AAPL", "100", "150", "160", "0.5"}, true},
+	}
+
+	cmds := newCommands()
+	for _, tt := range tests {
+		_, err := cmds.find(tt.args[0]).parse(tt.args[1:])
+		if (err == nil) != tt.ok {
+			t.Errorf("%v: error %v, want ok %v", tt.args, err, tt.ok)
+		}
+	}
+}
@@ -1,6 +1,11 @@
 {
     "Accounts" : [
         { "Label": "pr", "Gateway": "127.0.0.1:4001", "Client": 0, "Paper": true },
-        { "Label": "ib", "Gateway": "127.0.0.1:4002", "Client": 0, "Paper": false }
+        { "Label": "ib", "Gateway": "127.0.0.1:4002", "Client": 0, "Paper": false, "SkipConfirm": false }
+    ],
+    "Presets" : [
+        { "Name": "brkp1", "Target": "0.20", "Stop": "0.05" },
+        { "Name": "brkpct", "Target": "1.5%", "Stop": "0.5%", "StopType": "STP LMT", "StopLimit": "0.05", "TIF": "DAY", "OutsideRTH": false },
+        { "Name": "trail1", "Type": "trail", "Action": "SELL", "Trail": "1%" }
     ]
 }
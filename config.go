@@ -28,10 +28,68 @@ type Account struct {
 	Gateway string
 	Client  int64
 	Paper   bool
+
+	// SkipConfirm sends orders for a live account without the preview prompt
+	SkipConfirm bool
+}
+
+// Preset is a named bracket or trailing order template that becomes a command
+type Preset struct {
+	Name string
+	Help string
+	// Type is "bracket", the default, or "trail"
+	Type string
+
+	// Target and Stop are a bracket's offsets from the buy price,
+	// in dollars ("0.20") or percent ("1%")
+	Target     string
+	TargetType string // LMT (default) or MIT
+	Stop       string
+	StopType   string // STP (default) or STP LMT
+	// StopLimit is how far past the stop price a STP LMT stop may fill
+	StopLimit string
+
+	// Action and Trail describe a trailing order
+	Action string // SELL (default) or BUY
+	Trail  string
+
+	// TIF and OutsideRTH override the gtc and rth toggles when set
+	TIF        string
+	OutsideRTH *bool
+
+	target, stop, stopLimit, trail priceOffset
+}
+
+// defaultPresets are the brackets available without any Presets in the config
+func defaultPresets() []Preset {
+	return []Preset{
+		{Name: "brkp1", Target: "0.20", Stop: "0.05"},
+		{Name: "brkp2", Target: "0.11", Stop: "0.05"},
+	}
 }
 
 type Config struct {
 	Accounts []Account
+	Presets  []Preset
+}
+
+// presets returns the default presets, replaced by any in the config with the same name,
+// followed by the other presets in the config
+func (c *Config) presets() []Preset {
+	presets := defaultPresets()
+	for _, p := range c.Presets {
+		replaced := false
+		for i := range presets {
+			if presets[i].Name == p.Name {
+				presets[i] = p
+				replaced = true
+			}
+		}
+		if !replaced {
+			presets = append(presets, p)
+		}
+	}
+	return presets
 }
 
 func LoadConfigFromFile(filename string) (*Config, error) {
@@ -46,6 +104,17 @@ func LoadConfigFromFile(filename string) (*Config, error) {
 
 	config := Config{}
 	err = json.NewDecoder(file).Decode(&config)
+	if err != nil {
+		return &config, err
+	}
 
-	return &config, err
+	// presets are checked once here, with the defaults they are merged with,
+	// and the commands made from them trust them
+	config.Presets = config.presets()
+	for i := range config.Presets {
+		if err := config.Presets[i].check(); err != nil {
+			return &config, err
+		}
+	}
+	return &config, nil
 }
@@ -0,0 +1,283 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"log"
+	"time"
+)
+
+const (
+	// reconnectMinDelay is the wait before the first reconnect attempt
+	reconnectMinDelay = 1 * time.Second
+	// reconnectMaxDelay caps the wait between reconnect attempts
+	reconnectMaxDelay = 2 * time.Minute
+	// readyTimeout is how long orders wait for TWS to hand out order ids
+	readyTimeout = 10 * time.Second
+)
+
+type connState int
+
+const (
+	connDown connState = iota
+	connReconnecting
+	connUp
+)
+
+func (s connState) String() string {
+	switch s {
+	case connDown:
+		return "down"
+	case connReconnecting:
+		return "reconnecting"
+	case connUp:
+		return "up"
+	}
+	return "unknown"
+}
+
+// start connects the account and keeps it connected until stop is called
+func (m *IBManager) start() error {
+	m.mu.Lock()
+	if m.done != nil {
+		m.mu.Unlock()
+		return fmt.Errorf("%s is already connected", m.label)
+	}
+	done := make(chan struct{})
+	m.done = done
+	m.mu.Unlock()
+
+	engine, err := m.connect(done)
+	if err != nil {
+		m.mu.Lock()
+		if m.done == done {
+			m.done = nil
+			m.conn = connDown
+		}
+		m.mu.Unlock()
+		return err
+	}
+
+	go m.supervise(done, engine)
+	return nil
+}
+
+// stop closes the connection for good, the supervisor does not reconnect
+func (m *IBManager) stop() {
+	m.mu.Lock()
+	done := m.done
+	engine := m.engine
+	m.done = nil
+	m.engine = nil
+	m.ready = nil
+	m.conn = connDown
+	m.realtimeMap = make(map[int64]string)
+	m.accountUpdates = false
+	m.mu.Unlock()
+
+	if done != nil {
+		close(done)
+	}
+	if engine != nil {
+		engine.Stop()
+	}
+	m.failWaiters(fmt.Errorf("%s: disconnected", m.label))
+}
+
+// connect starts a new engine for the connection started with done
+func (m *IBManager) connect(done chan struct{}) (*ib.Engine, error) {
+	engine, err := ib.NewEngine(m.opts)
+	if err != nil {
+		return nil, err
+	}
+	if engine.State() != ib.EngineReady {
+		engine.Stop()
+		return nil, fmt.Errorf("engine is not ready")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.done != done {
+		engine.Stop()
+		return nil, fmt.Errorf("%s was disconnected", m.label)
+	}
+	m.engine = engine
+	m.ready = make(chan struct{})
+	m.conn = connUp
+	return engine, nil
+}
+
+// lost forgets the engine after its connection dropped
+func (m *IBManager) lost(done chan struct{}) {
+	m.mu.Lock()
+	if m.done != done {
+		m.mu.Unlock()
+		return
+	}
+	m.engine = nil
+	m.ready = nil
+	m.conn = connReconnecting
+	m.mu.Unlock()
+
+	m.failWaiters(fmt.Errorf("%s: connection lost", m.label))
+}
+
+// currentEngine returns the connected engine, or nil
+func (m *IBManager) currentEngine() *ib.Engine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.engine
+}
+
+func (m *IBManager) connState() connState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conn
+}
+
+// setReady marks the connection ready once TWS sent the next valid order id
+func (m *IBManager) setReady() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ready == nil {
+		return
+	}
+	select {
+	case <-m.ready:
+	default:
+		close(m.ready)
+	}
+}
+
+// waitReady waits until the connection has a valid order id
+func (m *IBManager) waitReady(timeout time.Duration) error {
+	m.mu.Lock()
+	ready := m.ready
+	m.mu.Unlock()
+
+	if ready == nil {
+		return fmt.Errorf("%s is not connected", m.label)
+	}
+	select {
+	case <-ready:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("%s: no order id from TWS after %v", m.label, timeout)
+	}
+}
+
+// orderable refuses orders for accounts that are not connected, and holds
+// them until the connection is ready
+func (m *IBManager) orderable() error {
+	if state := m.connState(); state != connUp {
+		return fmt.Errorf("%s is %s, order not sent", m.label, state)
+	}
+	return m.waitReady(readyTimeout)
+}
+
+// send passes a request to the engine, failing when the account is not connected
+func (m *IBManager) send(r ib.Request) error {
+	engine := m.currentEngine()
+	if engine == nil {
+		return fmt.Errorf("%s is not connected", m.label)
+	}
+	return engine.Send(r)
+}
+
+func (m *IBManager) nextRequestID() int64 {
+	engine := m.currentEngine()
+	if engine == nil {
+		return 0
+	}
+	return engine.NextRequestID()
+}
+
+// supervise runs engineLoop and reconnects with exponential backoff whenever
+// the connection is lost, until done is closed by stop
+func (m *IBManager) supervise(done chan struct{}, engine *ib.Engine) {
+	reconnected := false
+	for {
+		if engineLoop(m, engine, reconnected) {
+			return
+		}
+		m.lost(done)
+
+		delay := reconnectMinDelay
+		for {
+			log.Printf("%s: reconnecting in %v", m.label, delay)
+			select {
+			case <-done:
+				return
+			case <-time.After(delay):
+			}
+
+			var err error
+			engine, err = m.connect(done)
+			if err == nil {
+				break
+			}
+			log.Printf("%s: reconnect failed: %v", m.label, err)
+
+			delay *= 2
+			if delay > reconnectMaxDelay {
+				delay = reconnectMaxDelay
+			}
+		}
+		log.Printf("%s: reconnected", m.label)
+		reconnected = true
+	}
+}
+
+// resubscribe repeats the streaming requests made before the connection was lost
+func (m *IBManager) resubscribe() {
+	if err := m.waitReady(readyTimeout); err != nil {
+		log.Printf("%s: %v", m.label, err)
+		return
+	}
+
+	m.mu.Lock()
+	var symbols []string
+	for _, symbol := range m.realtimeMap {
+		symbols = append(symbols, symbol)
+	}
+	m.realtimeMap = make(map[int64]string)
+	updates := m.accountUpdates
+	m.mu.Unlock()
+
+	if updates {
+		req := &ib.RequestAccountUpdates{}
+		req.Subscribe = true
+		if err := m.send(req); err != nil {
+			log.Printf("%s: %v", m.label, err)
+		}
+	}
+	for _, symbol := range symbols {
+		if err := doRequestRealTimeBars(m, symbol); err != nil {
+			log.Printf("%s: %v", m.label, err)
+		}
+	}
+}
+
+func (m *IBManager) setAccountUpdates(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.accountUpdates = on
+}
@@ -0,0 +1,160 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	symbolPattern  = regexp.MustCompile(`^[A-Z0-9][A-Z0-9.]{0,11}$`)
+	exchPattern    = regexp.MustCompile(`^[A-Z][A-Z0-9.]*$`)
+	currPattern    = regexp.MustCompile(`^[A-Z]{3}$`)
+	futExpPattern  = regexp.MustCompile(`^[0-9]{6}([0-9]{2})?$`)
+	optExpPattern  = regexp.MustCompile(`^[0-9]{8}$`)
+	cashPairFormat = regexp.MustCompile(`^([A-Z]{3})\.([A-Z]{3})$`)
+)
+
+// ParseContract turns a contract spec into an ib.Contract.  Specs are
+//
+//	AAPL                              US stock on SMART
+//	VOD:LSE:GBP                       stock or ETF on an exchange, in a currency
+//	AAPL:STK[:exchange[:currency]]
+//	ES:FUT:202612:GLOBEX[:currency]   future with its expiry month
+//	AAPL:OPT:20261218:200:C[:exchange[:currency]]
+//	ES:FOP:20261218:6000:P:GLOBEX[:currency]
+//	EUR.USD:CASH                      forex pair on IDEALPRO
+func ParseContract(spec string) (ib.Contract, error) {
+	parts := strings.Split(strings.ToUpper(spec), ":")
+
+	contract := ib.Contract{
+		Symbol:       parts[0],
+		SecurityType: "STK",
+		Exchange:     "SMART",
+		Currency:     "USD",
+	}
+
+	rest := parts[1:]
+	if len(rest) > 0 {
+		switch rest[0] {
+		case "STK", "FUT", "OPT", "FOP", "CASH":
+			contract.SecurityType = rest[0]
+			rest = rest[1:]
+		}
+	}
+
+	if contract.SecurityType == "CASH" {
+		m := cashPairFormat.FindStringSubmatch(contract.Symbol)
+		if m == nil {
+			return contract, fmt.Errorf("forex pair must look like EUR.USD")
+		}
+		contract.Symbol = m[1]
+		contract.Currency = m[2]
+		contract.Exchange = "IDEALPRO"
+		if len(rest) > 0 {
+			return contract, fmt.Errorf("unexpected '%s' after forex pair", strings.Join(rest, ":"))
+		}
+		return contract, nil
+	}
+
+	if !symbolPattern.MatchString(contract.Symbol) {
+		return contract, fmt.Errorf("not a valid symbol")
+	}
+
+	switch contract.SecurityType {
+	case "FUT":
+		if len(rest) < 2 {
+			return contract, fmt.Errorf("futures need SYMBOL:FUT:YYYYMM:EXCHANGE")
+		}
+		if !futExpPattern.MatchString(rest[0]) {
+			return contract, fmt.Errorf("expiry '%s' must be YYYYMM or YYYYMMDD", rest[0])
+		}
+		contract.Expiry = rest[0]
+		contract.Exchange = ""
+		rest = rest[1:]
+
+	case "OPT", "FOP":
+		if len(rest) < 3 {
+			return contract, fmt.Errorf("options need SYMBOL:%s:YYYYMMDD:STRIKE:C|P", contract.SecurityType)
+		}
+		if !optExpPattern.MatchString(rest[0]) {
+			return contract, fmt.Errorf("expiry '%s' must be YYYYMMDD", rest[0])
+		}
+		strike, err := strconv.ParseFloat(rest[1], 64)
+		if err != nil || strike <= 0 {
+			return contract, fmt.Errorf("strike '%s' must be a positive price", rest[1])
+		}
+		switch rest[2] {
+		case "C", "CALL":
+			contract.Right = "C"
+		case "P", "PUT":
+			contract.Right = "P"
+		default:
+			return contract, fmt.Errorf("right '%s' must be C or P", rest[2])
+		}
+		contract.Expiry = rest[0]
+		contract.Strike = strike
+		if contract.SecurityType == "OPT" {
+			contract.Multiplier = "100"
+		} else {
+			contract.Exchange = ""
+		}
+		rest = rest[3:]
+	}
+
+	if len(rest) > 0 {
+		if !exchPattern.MatchString(rest[0]) {
+			return contract, fmt.Errorf("exchange '%s' is not valid", rest[0])
+		}
+		contract.Exchange = rest[0]
+		rest = rest[1:]
+	}
+	if contract.Exchange == "" {
+		return contract, fmt.Errorf("%s contracts need an exchange", contract.SecurityType)
+	}
+
+	if len(rest) > 0 {
+		if !currPattern.MatchString(rest[0]) {
+			return contract, fmt.Errorf("currency '%s' is not valid", rest[0])
+		}
+		contract.Currency = rest[0]
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 {
+		return contract, fmt.Errorf("unexpected '%s'", strings.Join(rest, ":"))
+	}
+	return contract, nil
+}
+
+// usesCentTicks tells whether the US equity tick size rules apply to a contract
+func usesCentTicks(c ib.Contract) bool {
+	return c.SecurityType == "STK" && c.Currency == "USD"
+}
+
+// multiplier is the number of units one contract stands for, 1 for stocks
+func multiplier(c ib.Contract) float64 {
+	if m, err := strconv.ParseFloat(c.Multiplier, 64); err == nil && m > 0 {
+		return m
+	}
+	return 1
+}
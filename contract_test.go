@@ -0,0 +1,91 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"github.com/gofinance/ib"
+	"reflect"
+	"testing"
+)
+
+func TestParseContract(t *testing.T) {
+	tests := []struct {
+		spec string
+		want ib.Contract
+	}{
+		{"aapl", ib.Contract{Symbol: "AAPL", SecurityType: "STK", Exchange: "SMART", Currency: "USD"}},
+		{"BRK.B", ib.Contract{Symbol: "BRK.B", SecurityType: "STK", Exchange: "SMART", Currency: "USD"}},
+		{"VOD:LSE:GBP", ib.Contract{Symbol: "VOD", SecurityType: "STK", Exchange: "LSE", Currency: "GBP"}},
+		{"SAP:STK:IBIS:EUR", ib.Contract{Symbol: "SAP", SecurityType: "STK", Exchange: "IBIS", Currency: "EUR"}},
+		{"ES:FUT:202612:GLOBEX", ib.Contract{Symbol: "ES", SecurityType: "FUT", Expiry: "202612", Exchange: "GLOBEX", Currency: "USD"}},
+		{"AAPL:OPT:20261218:200:C", ib.Contract{Symbol: "AAPL", SecurityType: "OPT", Expiry: "20261218", Strike: 200, Right: "C", Multiplier: "100", Exchange: "SMART", Currency: "USD"}},
+		{"ES:FOP:20261218:6000:put:GLOBEX", ib.Contract{Symbol: "ES", SecurityType: "FOP", Expiry: "20261218", Strike: 6000, Right: "P", Exchange: "GLOBEX", Currency: "USD"}},
+		{"EUR.USD:CASH", ib.Contract{Symbol: "EUR", SecurityType: "CASH", Exchange: "IDEALPRO", Currency: "USD"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseContract(tt.spec)
+		if err != nil {
+			t.Errorf("%s: %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseContractErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"AAPL$",
+		"EURUSD:CASH",
+		"EUR.USD:CASH:IDEALPRO",
+		"ES:FUT:202612",
+		"ES:FUT:2026:GLOBEX",
+		"AAPL:OPT:20261218:200",
+		"AAPL:OPT:2026-12-18:200:C",
+		"AAPL:OPT:20261218:-5:C",
+		"AAPL:OPT:20261218:200:X",
+		"ES:FOP:20261218:6000:P",
+		"VOD:LSE:POUNDS",
+		"VOD:LSE:GBP:EXTRA",
+	} {
+		if c, err := ParseContract(spec); err == nil {
+			t.Errorf("%q parsed as %+v", spec, c)
+		}
+	}
+}
+
+func TestUsesCentTicks(t *testing.T) {
+	tests := map[string]bool{
+		"AAPL":                    true,
+		"VOD:LSE:GBP":             false,
+		"ES:FUT:202612:GLOBEX":    false,
+		"AAPL:OPT:20261218:200:C": false,
+		"EUR.USD:CASH":            false,
+	}
+	for spec, want := range tests {
+		c, err := ParseContract(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		if got := usesCentTicks(c); got != want {
+			t.Errorf("usesCentTicks(%s) = %v, want %v", spec, got, want)
+		}
+	}
+}
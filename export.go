@@ -0,0 +1,235 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// exportRow is one execution written by elog export
+type exportRow struct {
+	Label string
+	*executionRecord
+}
+
+func checkExportFormat(format string) error {
+	switch format {
+	case "csv", "json", "ofx":
+		return nil
+	}
+	return fmt.Errorf("export format must be csv, json or ofx")
+}
+
+// exportExecutions writes the executions to filename
+func exportExecutions(filename string, format string, rows []exportRow) error {
+	if format == "ofx" {
+		if err := checkOFXRows(rows); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "csv":
+		err = writeExecutionsCSV(file, rows)
+	case "json":
+		err = writeExecutionsJSON(file, rows)
+	case "ofx":
+		err = writeExecutionsOFX(file, rows)
+	default:
+		err = checkExportFormat(format)
+	}
+
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func writeExecutionsCSV(w io.Writer, rows []exportRow) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Date", "Time", "Account", "AccountNumber", "Symbol", "Side", "Shares", "Price",
+		"CumQty", "AvgPrice", "Commission", "RealizedPNL", "Exchange", "Currency", "OrderID", "ExecID"})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.ExecTime.Format("2006-01-02"),
+			r.ExecTime.Format("15:04:05"),
+			r.Label,
+			r.AccountNumber,
+			r.Symbol,
+			r.Side,
+			strconv.FormatInt(r.Shares, 10),
+			strconv.FormatFloat(r.Price, 'f', -1, 64),
+			strconv.FormatInt(r.CumQty, 10),
+			strconv.FormatFloat(r.AveragePrice, 'f', -1, 64),
+			strconv.FormatFloat(r.Commission, 'f', -1, 64),
+			strconv.FormatFloat(r.RealizedPNL, 'f', -1, 64),
+			r.Exchange,
+			r.Currency,
+			strconv.FormatInt(r.OrderID, 10),
+			r.ExecID,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeExecutionsJSON(w io.Writer, rows []exportRow) error {
+	type execution struct {
+		Date    string
+		Account string
+		*executionRecord
+	}
+	executions := make([]execution, 0, len(rows))
+	for _, r := range rows {
+		executions = append(executions, execution{
+			Date:            r.ExecTime.Format("2006-01-02"),
+			Account:         r.Label,
+			executionRecord: r.executionRecord,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(executions)
+}
+
+// ofxTime formats a time the way OFX wants it
+func ofxTime(t time.Time) string {
+	return t.Format("20060102150405")
+}
+
+func ofxText(str string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(str))
+	return b.String()
+}
+
+// checkOFXRows refuses executions that are not stocks, which the OFX export
+// would write as stock trades without their multiplier
+func checkOFXRows(rows []exportRow) error {
+	for _, r := range rows {
+		if r.SecurityType != "" && r.SecurityType != "STK" {
+			return fmt.Errorf("OFX export only covers stocks, %s %s is %s, use csv or json", r.ExecID, r.Symbol, r.SecurityType)
+		}
+	}
+	return nil
+}
+
+// ofxStatement is the fills of one IB account in one currency
+type ofxStatement struct {
+	account  string
+	currency string
+}
+
+// writeExecutionsOFX writes an OFX 2 investment statement per IB account and
+// currency, with every fill as a stock buy or sell
+func writeExecutionsOFX(w io.Writer, rows []exportRow) error {
+	if err := checkOFXRows(rows); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	statements := []ofxStatement{}
+	byStatement := make(map[ofxStatement][]exportRow)
+	symbols := []string{}
+	seen := make(map[string]bool)
+	for _, r := range rows {
+		st := ofxStatement{account: r.AccountNumber, currency: r.Currency}
+		if st.account == "" {
+			st.account = r.Label
+		}
+		if st.currency == "" {
+			st.currency = "USD"
+		}
+		if _, ok := byStatement[st]; !ok {
+			statements = append(statements, st)
+		}
+		byStatement[st] = append(byStatement[st], r)
+		if !seen[r.Symbol] {
+			seen[r.Symbol] = true
+			symbols = append(symbols, r.Symbol)
+		}
+	}
+
+	var b bytes.Buffer
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"no\"?>\n")
+	b.WriteString("<?OFX OFXHEADER=\"200\" VERSION=\"211\" SECURITY=\"NONE\" OLDFILEUID=\"NONE\" NEWFILEUID=\"NONE\"?>\n")
+	b.WriteString("<OFX>\n")
+	fmt.Fprintf(&b, "<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS><DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n", ofxTime(now))
+	b.WriteString("<INVSTMTMSGSRSV1>\n")
+
+	for _, st := range statements {
+		fills := byStatement[st]
+		start, end := fills[0].ExecTime, fills[0].ExecTime
+		for _, r := range fills {
+			if r.ExecTime.Before(start) {
+				start = r.ExecTime
+			}
+			if r.ExecTime.After(end) {
+				end = r.ExecTime
+			}
+		}
+
+		b.WriteString("<INVSTMTTRNRS><TRNUID>0</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+		fmt.Fprintf(&b, "<INVSTMTRS><DTASOF>%s</DTASOF><CURDEF>%s</CURDEF>\n", ofxTime(now), ofxText(st.currency))
+		fmt.Fprintf(&b, "<INVACCTFROM><BROKERID>interactivebrokers.com</BROKERID><ACCTID>%s</ACCTID></INVACCTFROM>\n", ofxText(st.account))
+		fmt.Fprintf(&b, "<INVTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", ofxTime(start), ofxTime(end))
+
+		for _, r := range fills {
+			units := float64(r.Shares)
+			total := -(units*r.Price + r.Commission)
+			tran, inner, kind := "BUYSTOCK", "INVBUY", "<BUYTYPE>BUY</BUYTYPE>"
+			if r.Side == "SLD" {
+				units = -units
+				total = float64(r.Shares)*r.Price - r.Commission
+				tran, inner, kind = "SELLSTOCK", "INVSELL", "<SELLTYPE>SELL</SELLTYPE>"
+			}
+			fmt.Fprintf(&b, "<%s><%s><INVTRAN><FITID>%s</FITID><DTTRADE>%s</DTTRADE></INVTRAN>", tran, inner, ofxText(r.ExecID), ofxTime(r.ExecTime))
+			fmt.Fprintf(&b, "<SECID><UNIQUEID>%s</UNIQUEID><UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE></SECID>", ofxText(r.Symbol))
+			fmt.Fprintf(&b, "<UNITS>%v</UNITS><UNITPRICE>%v</UNITPRICE><COMMISSION>%.2f</COMMISSION><TOTAL>%.2f</TOTAL>", units, r.Price, r.Commission, total)
+			fmt.Fprintf(&b, "<SUBACCTSEC>CASH</SUBACCTSEC><SUBACCTFUND>CASH</SUBACCTFUND></%s>%s</%s>\n", inner, kind, tran)
+		}
+
+		b.WriteString("</INVTRANLIST></INVSTMTRS></INVSTMTTRNRS>\n")
+	}
+	b.WriteString("</INVSTMTMSGSRSV1>\n")
+
+	b.WriteString("<SECLISTMSGSRSV1><SECLIST>\n")
+	for _, symbol := range symbols {
+		fmt.Fprintf(&b, "<STOCKINFO><SECINFO><SECID><UNIQUEID>%s</UNIQUEID><UNIQUEIDTYPE>TICKER</UNIQUEIDTYPE></SECID><SECNAME>%s</SECNAME><TICKER>%s</TICKER></SECINFO></STOCKINFO>\n",
+			ofxText(symbol), ofxText(symbol), ofxText(symbol))
+	}
+	b.WriteString("</SECLIST></SECLISTMSGSRSV1>\n")
+	b.WriteString("</OFX>\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
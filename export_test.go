@@ -0,0 +1,101 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportTestRows() []exportRow {
+	at := time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+	return []exportRow{
+		{"ib1", &executionRecord{ExecID: "e1", ExecTime: at, AccountNumber: "U1", OrderID: 7, Symbol: "AAPL", SecurityType: "STK", Currency: "USD",
+			Side: "BOT", Shares: 100, Price: 150.25, CumQty: 100, AveragePrice: 150.25, Commission: 1, Exchange: "ISLAND"}},
+		{"ib1", &executionRecord{ExecID: "e2", ExecTime: at.Add(time.Hour), AccountNumber: "U1", OrderID: 8, Symbol: "AAPL", SecurityType: "STK", Currency: "USD",
+			Side: "SLD", Shares: 100, Price: 151, CumQty: 100, AveragePrice: 151, Commission: 1, RealizedPNL: 73, Exchange: "ISLAND"}},
+		{"ib2", &executionRecord{ExecID: "e3", ExecTime: at, AccountNumber: "U1", OrderID: 9, Symbol: "VOD", SecurityType: "STK", Currency: "GBP",
+			Side: "BOT", Shares: 10, Price: 0.7, CumQty: 10, AveragePrice: 0.7, Commission: 3, Exchange: "LSE"}},
+	}
+}
+
+func TestWriteExecutionsCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeExecutionsCSV(&b, exportTestRows()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("%d records, want a header and 3 rows", len(records))
+	}
+	want := []string{"2026-03-02", "14:30:00", "ib1", "U1", "AAPL", "BOT", "100", "150.25", "100", "150.25", "1", "0", "ISLAND", "USD", "7", "e1"}
+	if got := strings.Join(records[1], ","); got != strings.Join(want, ",") {
+		t.Errorf("first row\n got %s\nwant %s", got, strings.Join(want, ","))
+	}
+	if records[0][0] != "Date" || len(records[0]) != len(want) {
+		t.Errorf("header %v", records[0])
+	}
+}
+
+func TestWriteExecutionsOFX(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeExecutionsOFX(&b, exportTestRows()); err != nil {
+		t.Fatal(err)
+	}
+	ofx := b.String()
+
+	for _, want := range []string{
+		// one statement for each currency of the account
+		"<CURDEF>USD</CURDEF>",
+		"<CURDEF>GBP</CURDEF>",
+		"<BUYSTOCK><INVBUY><INVTRAN><FITID>e1</FITID><DTTRADE>20260302143000</DTTRADE></INVTRAN>",
+		"<UNITS>100</UNITS><UNITPRICE>150.25</UNITPRICE><COMMISSION>1.00</COMMISSION><TOTAL>-15026.00</TOTAL>",
+		"<SELLSTOCK><INVSELL><INVTRAN><FITID>e2</FITID>",
+		"<UNITS>-100</UNITS><UNITPRICE>151</UNITPRICE><COMMISSION>1.00</COMMISSION><TOTAL>15099.00</TOTAL>",
+		"<UNITS>10</UNITS><UNITPRICE>0.7</UNITPRICE><COMMISSION>3.00</COMMISSION><TOTAL>-10.00</TOTAL>",
+		"<TICKER>VOD</TICKER>",
+	} {
+		if !strings.Contains(ofx, want) {
+			t.Errorf("OFX is missing %s", want)
+		}
+	}
+	if n := strings.Count(ofx, "<INVSTMTRS>"); n != 2 {
+		t.Errorf("%d statements, want 2", n)
+	}
+	if n := strings.Count(ofx, "<STOCKINFO>"); n != 2 {
+		t.Errorf("%d securities, want 2", n)
+	}
+}
+
+func TestWriteExecutionsOFXOnlyStocks(t *testing.T) {
+	rows := exportTestRows()
+	rows[1].SecurityType = "OPT"
+	var b bytes.Buffer
+	if err := writeExecutionsOFX(&b, rows); err == nil {
+		t.Errorf("options written as stock trades")
+	}
+	if b.Len() != 0 {
+		t.Errorf("wrote %d bytes before refusing", b.Len())
+	}
+}
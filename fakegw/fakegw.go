@@ -0,0 +1,532 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+// Package fakegw is a local stand-in for TWS / IB Gateway.
+//
+// It speaks enough of the TWS socket protocol for ib.NewEngine to connect,
+// hands out order ids, records the orders and cancels it receives and
+// answers them with scripted replies, so ibstockcli can run offline.
+package fakegw
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Order is a PlaceOrder request as received by the gateway
+type Order struct {
+	ID             int64
+	Symbol         string
+	SecurityType   string
+	Exchange       string
+	Currency       string
+	Action         string
+	TotalQty       int64
+	OrderType      string
+	LimitPrice     float64
+	AuxPrice       float64
+	TrailStopPrice float64
+	TIF            string
+	OutsideRTH     bool
+	Transmit       bool
+	ParentID       int64
+	WhatIf         bool
+}
+
+// fakePrice is the price market orders fill at and realtime bars trade at
+const fakePrice = 100.0
+
+// barInterval is how often a realtime bar subscription gets a new bar
+const barInterval = 5 * time.Second
+
+// historyDays is the number of daily bars sent when Server.History is nil
+const historyDays = 30
+
+// Script decides the replies to an order.  DefaultScript is used when nil.
+type Script func(s *Server, o Order) []Reply
+
+type Server struct {
+	// Script answers every PlaceOrder
+	Script Script
+	// Account is reported in ManagedAccounts and fills
+	Account string
+	// Holdings are returned for RequestPositions
+	Holdings []Holding
+	// Listings answer RequestContractData by symbol.  When nil every
+	// symbol is listed once as a US stock.
+	Listings map[string][]Listing
+	// Summary answers RequestAccountSummary by tag
+	Summary map[string]string
+	// History answers every RequestHistoricalData.  When nil the last
+	// historyDays days are sent as bars 1.00 either side of fakePrice.
+	History []Bar
+
+	listener net.Listener
+
+	mu      sync.Mutex
+	nextID  int64
+	execs   int64
+	orders  []Order
+	cancels []int64
+	fills   []Fill
+	clients map[*client]bool
+}
+
+type client struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	mu   sync.Mutex
+	wr   *bufio.Writer
+
+	// bars holds a stop channel for each realtime bar subscription
+	bars map[int64]chan struct{}
+}
+
+// NewServer listens on addr, e.g. "127.0.0.1:0" for any free port
+func NewServer(addr string) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Account: "DU000000",
+		Summary: map[string]string{
+			"NetLiquidation": "100000.00",
+			"AvailableFunds": "50000.00",
+		},
+		listener: l,
+		nextID:   1,
+		clients:  make(map[*client]bool),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Addr is the gateway address to put in EngineOptions
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	return err
+}
+
+// SetNextValidID sets the id handed out to the next client that connects
+func (s *Server) SetNextValidID(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID = id
+}
+
+// Orders returns every order received so far
+func (s *Server) Orders() []Order {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Order(nil), s.orders...)
+}
+
+// Cancels returns the ids of every CancelOrder received so far
+func (s *Server) Cancels() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.cancels...)
+}
+
+// Broadcast sends an unsolicited reply to every connected client
+func (s *Server) Broadcast(r Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.send(r)
+	}
+}
+
+// Fill builds an execution of the whole order at price and remembers it for RequestExecutions
+func (s *Server) Fill(o Order, price float64) Fill {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.execs++
+	f := Fill{
+		OrderID:      o.ID,
+		ExecID:       fmt.Sprintf("0000fake.%08d.01.01", s.execs),
+		Time:         time.Now(),
+		Account:      s.Account,
+		Symbol:       o.Symbol,
+		Side:         "BOT",
+		Shares:       o.TotalQty,
+		Price:        price,
+		CumQty:       o.TotalQty,
+		AveragePrice: price,
+		Exchange:     "ISLAND",
+		Commission:   1.0,
+	}
+	if o.Action == "SELL" {
+		f.Side = "SLD"
+	}
+	s.fills = append(s.fills, f)
+	return f
+}
+
+// DefaultScript accepts every order, and fills market orders straight away
+func DefaultScript(s *Server, o Order) []Reply {
+	if o.WhatIf {
+		return nil
+	}
+	if !o.Transmit {
+		return []Reply{OrderStatus(o.ID, "PreSubmitted", 0, o.TotalQty, 0, o.ParentID)}
+	}
+	if o.OrderType != "MKT" {
+		return []Reply{OrderStatus(o.ID, "Submitted", 0, o.TotalQty, 0, o.ParentID)}
+	}
+
+	f := s.Fill(o, fakePrice)
+	f.RequestID = -1
+	return []Reply{
+		OrderStatus(o.ID, "Submitted", 0, o.TotalQty, 0, o.ParentID),
+		ExecutionData(f),
+		CommissionReport(f),
+		OrderStatus(o.ID, "Filled", o.TotalQty, 0, f.Price, o.ParentID),
+	}
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	c := &client{
+		conn: conn,
+		rd:   bufio.NewReader(conn),
+		wr:   bufio.NewWriter(conn),
+		bars: make(map[int64]chan struct{}),
+	}
+	defer conn.Close()
+	defer c.stopBars()
+
+	// client version, then our version and time, then the client id
+	if _, err := c.readInt(); err != nil {
+		return
+	}
+	c.send(Reply{strconv.Itoa(serverVersion), time.Now().Format("20060102 15:04:05 MST")})
+	if _, err := c.readInt(); err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.clients[c] = true
+	nextID := s.nextID
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	c.send(NextValidID(nextID))
+	c.send(ManagedAccounts(s.Account))
+
+	for {
+		code, err := c.readInt()
+		if err != nil {
+			return
+		}
+		count, ok := requestFields[int(code)]
+		if !ok {
+			log.Printf("fakegw: unsupported message %d, closing connection", code)
+			return
+		}
+		msg := make([]string, count)
+		for i := range msg {
+			if msg[i], err = c.readField(); err != nil {
+				return
+			}
+		}
+		s.handle(c, int(code), msg[1:])
+	}
+}
+
+func (s *Server) handle(c *client, code int, msg []string) {
+	switch code {
+	case mPlaceOrder:
+		o := parseOrder(msg)
+		s.mu.Lock()
+		s.orders = append(s.orders, o)
+		if o.ID >= s.nextID {
+			s.nextID = o.ID + 1
+		}
+		script := s.Script
+		s.mu.Unlock()
+
+		if script == nil {
+			script = DefaultScript
+		}
+		for _, r := range script(s, o) {
+			c.send(r)
+		}
+
+	case mCancelOrder:
+		id := atoi(msg[0])
+		s.mu.Lock()
+		s.cancels = append(s.cancels, id)
+		s.mu.Unlock()
+		c.send(OrderStatus(id, "Cancelled", 0, 0, 0, 0))
+
+	case mRequestIDs:
+		s.mu.Lock()
+		nextID := s.nextID
+		s.mu.Unlock()
+		c.send(NextValidID(nextID))
+
+	case mRequestExecutions:
+		reqID := atoi(msg[0])
+		s.mu.Lock()
+		fills := append([]Fill(nil), s.fills...)
+		s.mu.Unlock()
+		for _, f := range fills {
+			f.RequestID = reqID
+			c.send(ExecutionData(f))
+			c.send(CommissionReport(f))
+		}
+		c.send(ExecutionDataEnd(reqID))
+
+	case mRequestContractData:
+		reqID := atoi(msg[0])
+		symbol := msg[2]
+		listings, ok := s.Listings[symbol]
+		if s.Listings == nil {
+			listings, ok = []Listing{{
+				ContractID:   fakeContractID(symbol),
+				Symbol:       symbol,
+				SecurityType: msg[3],
+				Exchange:     msg[8],
+				Currency:     msg[9],
+				LongName:     symbol + " FAKE INC",
+				MinTick:      0.01,
+			}}, true
+		}
+		if !ok {
+			c.send(ErrorMessage(reqID, 200, "No security definition has been found for the request"))
+			break
+		}
+		for _, l := range listings {
+			c.send(ContractData(reqID, l))
+		}
+		c.send(ContractDataEnd(reqID))
+
+	case mRequestPositions:
+		for _, h := range s.Holdings {
+			c.send(Position(h))
+		}
+		c.send(PositionEnd())
+
+	case mRequestOpenOrders, mRequestAllOpenOrders:
+		c.send(OpenOrderEnd())
+
+	case mRequestAccountUpdates:
+		if msg[0] == "1" {
+			c.send(AccountDownloadEnd(s.Account))
+		}
+
+	case mRequestManagedAccounts:
+		c.send(ManagedAccounts(s.Account))
+
+	case mRequestRealTimeBars:
+		c.streamBars(atoi(msg[0]))
+
+	case mCancelRealTimeBars:
+		c.cancelBars(atoi(msg[0]))
+
+	case mRequestHistoricalData:
+		bars := s.History
+		if bars == nil {
+			bars = DailyBars(historyDays, time.Now())
+		}
+		c.send(HistoricalData(atoi(msg[0]), bars))
+
+	case mCancelHistoricalData:
+
+	case mRequestAccountSummary:
+		reqID := atoi(msg[0])
+		for _, tag := range strings.Split(msg[2], ",") {
+			if value, ok := s.Summary[tag]; ok {
+				c.send(AccountSummary(reqID, s.Account, tag, value))
+			}
+		}
+		c.send(AccountSummaryEnd(reqID))
+	}
+}
+
+// DailyBars makes n daily bars up to the day before end, each 1.00 either
+// side of fakePrice so the ATR is 2.00
+func DailyBars(n int, end time.Time) []Bar {
+	day := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.Local)
+	bars := make([]Bar, n)
+	for i := range bars {
+		bars[i] = Bar{
+			Date:   day.AddDate(0, 0, i-n),
+			Open:   fakePrice,
+			High:   fakePrice + 1,
+			Low:    fakePrice - 1,
+			Close:  fakePrice,
+			Volume: 1000,
+		}
+	}
+	return bars
+}
+
+// streamBars sends a realtime bar now and every barInterval until cancelled
+func (c *client) streamBars(reqID int64) {
+	stop := make(chan struct{})
+	c.mu.Lock()
+	if old, ok := c.bars[reqID]; ok {
+		close(old)
+	}
+	c.bars[reqID] = stop
+	c.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(barInterval)
+		defer ticker.Stop()
+		for {
+			c.send(RealtimeBar(reqID, time.Now(), fakePrice, fakePrice+0.05, fakePrice-0.05, fakePrice, 100))
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *client) cancelBars(reqID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stop, ok := c.bars[reqID]; ok {
+		close(stop)
+		delete(c.bars, reqID)
+	}
+}
+
+// stopBars ends every subscription when the client goes away
+func (c *client) stopBars() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, stop := range c.bars {
+		close(stop)
+		delete(c.bars, id)
+	}
+}
+
+func parseOrder(msg []string) Order {
+	f := make(map[string]string, len(placeOrderFields))
+	for i, name := range placeOrderFields {
+		f[name] = msg[i]
+	}
+	return Order{
+		ID:             atoi(f["id"]),
+		Symbol:         f["symbol"],
+		SecurityType:   f["secType"],
+		Exchange:       f["exchange"],
+		Currency:       f["currency"],
+		Action:         f["action"],
+		TotalQty:       atoi(f["totalQty"]),
+		OrderType:      f["orderType"],
+		LimitPrice:     atof(f["lmtPrice"]),
+		AuxPrice:       atof(f["auxPrice"]),
+		TrailStopPrice: atof(f["trailStopPrice"]),
+		TIF:            f["tif"],
+		OutsideRTH:     f["outsideRth"] == "1",
+		Transmit:       f["transmit"] == "1",
+		ParentID:       atoi(f["parentId"]),
+		WhatIf:         f["whatIf"] == "1",
+	}
+}
+
+// fakeContractID gives every symbol a stable made up conId
+func fakeContractID(symbol string) int64 {
+	id := int64(1000)
+	for _, ch := range symbol {
+		id = id*31 + int64(ch)
+	}
+	if id < 0 {
+		id = -id
+	}
+	return id
+}
+
+func atoi(str string) int64 {
+	val, _ := strconv.ParseInt(str, 10, 64)
+	return val
+}
+
+// atof treats the empty string TWS uses for unset prices as zero
+func atof(str string) float64 {
+	val, _ := strconv.ParseFloat(str, 64)
+	if val > 1e300 {
+		return 0
+	}
+	return val
+}
+
+func (c *client) readField() (string, error) {
+	str, err := c.rd.ReadString(0)
+	if err != nil {
+		return "", err
+	}
+	return str[:len(str)-1], nil
+}
+
+func (c *client) readInt() (int64, error) {
+	str, err := c.readField()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(str, 10, 64)
+}
+
+func (c *client) send(r Reply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range r {
+		c.wr.WriteString(f)
+		c.wr.WriteByte(0)
+	}
+	c.wr.Flush()
+}
@@ -0,0 +1,253 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package fakegw
+
+import (
+	"github.com/gofinance/ib"
+	"testing"
+	"time"
+)
+
+const replyTimeout = 5 * time.Second
+
+// connect starts a gateway and an engine talking to it
+func connect(t *testing.T) (*Server, *ib.Engine, chan ib.Reply) {
+	s, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetNextValidID(1000)
+
+	engine, err := ib.NewEngine(ib.EngineOptions{Gateway: s.Addr()})
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	if engine.State() != ib.EngineReady {
+		engine.Stop()
+		s.Close()
+		t.Fatalf("engine state %v", engine.State())
+	}
+
+	replies := make(chan ib.Reply, 100)
+	engine.SubscribeAll(replies)
+	t.Cleanup(func() {
+		engine.Stop()
+		s.Close()
+	})
+	return s, engine, replies
+}
+
+// waitFor reads replies until match accepts one
+func waitFor(t *testing.T, replies chan ib.Reply, what string, match func(ib.Reply) bool) ib.Reply {
+	t.Helper()
+	timeout := time.After(replyTimeout)
+	for {
+		select {
+		case r := <-replies:
+			if match(r) {
+				return r
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func stock(symbol string) ib.Contract {
+	return ib.Contract{Symbol: symbol, SecurityType: "STK", Exchange: "SMART", Currency: "USD"}
+}
+
+func TestMarketOrderFills(t *testing.T) {
+	s, engine, replies := connect(t)
+
+	if err := engine.Send(&ib.RequestIDs{}); err != nil {
+		t.Fatal(err)
+	}
+	r := waitFor(t, replies, "NextValidID", func(r ib.Reply) bool {
+		_, ok := r.(*ib.NextValidID)
+		return ok
+	})
+	id := r.(*ib.NextValidID).OrderID
+	if id != 1000 {
+		t.Fatalf("NextValidID %v, want 1000", id)
+	}
+
+	order, err := ib.NewOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order.Action = "BUY"
+	order.TotalQty = 10
+	order.OrderType = "MKT"
+	order.Transmit = true
+	req := &ib.PlaceOrder{Contract: stock("AAPL"), Order: order}
+	req.SetID(id)
+	if err := engine.Send(req); err != nil {
+		t.Fatal(err)
+	}
+
+	r = waitFor(t, replies, "ExecutionData", func(r ib.Reply) bool {
+		_, ok := r.(*ib.ExecutionData)
+		return ok
+	})
+	exec := r.(*ib.ExecutionData)
+	if exec.Exec.OrderID != id || exec.Exec.Shares != 10 || exec.Exec.Price != fakePrice || exec.Exec.Side != "BOT" {
+		t.Errorf("execution %+v", exec.Exec)
+	}
+	if exec.Contract.Symbol != "AAPL" {
+		t.Errorf("execution symbol %q", exec.Contract.Symbol)
+	}
+
+	r = waitFor(t, replies, "CommissionReport", func(r ib.Reply) bool {
+		_, ok := r.(*ib.CommissionReport)
+		return ok
+	})
+	if c := r.(*ib.CommissionReport); c.ExecutionID != exec.Exec.ExecID || c.Commission != 1.0 {
+		t.Errorf("commission %+v for %s", c, exec.Exec.ExecID)
+	}
+
+	r = waitFor(t, replies, "OrderStatus Filled", func(r ib.Reply) bool {
+		st, ok := r.(*ib.OrderStatus)
+		return ok && st.Status == "Filled"
+	})
+	if st := r.(*ib.OrderStatus); st.ID() != id || st.Filled != 10 || st.Remaining != 0 {
+		t.Errorf("status %+v", st)
+	}
+
+	orders := s.Orders()
+	if len(orders) != 1 {
+		t.Fatalf("%d orders received, want 1", len(orders))
+	}
+	if o := orders[0]; o.ID != id || o.Symbol != "AAPL" || o.Action != "BUY" || o.TotalQty != 10 || o.OrderType != "MKT" || !o.Transmit {
+		t.Errorf("order received as %+v", o)
+	}
+}
+
+func TestRealTimeBarsKeepConnection(t *testing.T) {
+	_, engine, replies := connect(t)
+
+	req := &ib.RequestRealTimeBars{
+		Contract:   stock("AAPL"),
+		BarSize:    5,
+		WhatToShow: ib.RealTimeTrades,
+		UseRTH:     true,
+	}
+	req.SetID(engine.NextRequestID())
+	if err := engine.Send(req); err != nil {
+		t.Fatal(err)
+	}
+
+	r := waitFor(t, replies, "RealtimeBars", func(r ib.Reply) bool {
+		_, ok := r.(*ib.RealtimeBars)
+		return ok
+	})
+	if bar := r.(*ib.RealtimeBars); bar.ID() != req.ID() || bar.Close != fakePrice {
+		t.Errorf("bar %+v", bar)
+	}
+
+	cancel := &ib.CancelRealTimeBars{}
+	cancel.SetID(req.ID())
+	if err := engine.Send(cancel); err != nil {
+		t.Fatal(err)
+	}
+
+	// the connection is still usable after both messages
+	if err := engine.Send(&ib.RequestIDs{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, replies, "NextValidID", func(r ib.Reply) bool {
+		_, ok := r.(*ib.NextValidID)
+		return ok
+	})
+	if engine.State() != ib.EngineReady {
+		t.Errorf("engine state %v after realtime bars", engine.State())
+	}
+}
+
+func TestAccountSummary(t *testing.T) {
+	s, engine, replies := connect(t)
+
+	req := &ib.RequestAccountSummary{Group: "All", Tags: "NetLiquidation,AvailableFunds,BuyingPower"}
+	req.SetID(engine.NextRequestID())
+	if err := engine.Send(req); err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]string)
+	waitFor(t, replies, "AccountSummaryEnd", func(r ib.Reply) bool {
+		switch r := r.(type) {
+		case *ib.AccountSummary:
+			if r.Key.AccountCode != s.Account {
+				t.Errorf("summary for account %q", r.Key.AccountCode)
+			}
+			values[r.Key.Key] = r.Value
+		case *ib.AccountSummaryEnd:
+			return true
+		}
+		return false
+	})
+
+	if len(values) != 2 || values["NetLiquidation"] != "100000.00" || values["AvailableFunds"] != "50000.00" {
+		t.Errorf("account summary %v", values)
+	}
+}
+
+func TestHistoricalData(t *testing.T) {
+	_, engine, replies := connect(t)
+
+	req := &ib.RequestHistoricalData{
+		Contract:    stock("AAPL"),
+		EndDateTime: time.Now(),
+		Duration:    "3 M",
+		BarSize:     ib.HistBarSize1Day,
+		WhatToShow:  ib.HistTrades,
+		UseRTH:      true,
+	}
+	req.SetID(engine.NextRequestID())
+	if err := engine.Send(req); err != nil {
+		t.Fatal(err)
+	}
+
+	r := waitFor(t, replies, "HistoricalData", func(r ib.Reply) bool {
+		_, ok := r.(*ib.HistoricalData)
+		return ok
+	})
+	data := r.(*ib.HistoricalData)
+	if data.ID() != req.ID() || len(data.Data) != historyDays {
+		t.Fatalf("historical data %v with %d bars", data.ID(), len(data.Data))
+	}
+	yesterday := time.Now().AddDate(0, 0, -1).Format("20060102")
+	if last := data.Data[historyDays-1]; last.Date.Format("20060102") != yesterday || last.High != fakePrice+1 || last.Low != fakePrice-1 {
+		t.Errorf("last bar %+v", last)
+	}
+
+	// the connection is still usable after the request and its cancel
+	cancel := &ib.CancelHistoricalData{}
+	cancel.SetID(req.ID())
+	if err := engine.Send(cancel); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.Send(&ib.RequestIDs{}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, replies, "NextValidID", func(r ib.Reply) bool {
+		_, ok := r.(*ib.NextValidID)
+		return ok
+	})
+}
@@ -0,0 +1,274 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package fakegw
+
+import (
+	"strconv"
+	"time"
+)
+
+// Message codes sent by the client
+const (
+	mPlaceOrder             = 3
+	mCancelOrder            = 4
+	mRequestOpenOrders      = 5
+	mRequestAccountUpdates  = 6
+	mRequestExecutions      = 7
+	mRequestIDs             = 8
+	mRequestContractData    = 9
+	mRequestHistoricalData  = 20
+	mCancelHistoricalData   = 25
+	mRequestAllOpenOrders   = 16
+	mRequestManagedAccounts = 17
+	mRequestRealTimeBars    = 50
+	mCancelRealTimeBars     = 51
+	mRequestGlobalCancel    = 58
+	mRequestPositions       = 61
+	mRequestAccountSummary  = 62
+	mCancelAccountSummary   = 63
+	mCancelPositions        = 64
+)
+
+// Message codes sent by the gateway
+const (
+	rOrderStatus        = 3
+	rErrorMessage       = 4
+	rNextValidID        = 9
+	rContractData       = 10
+	rExecutionData      = 11
+	rManagedAccounts    = 15
+	rHistoricalData     = 17
+	rContractDataEnd    = 52
+	rOpenOrderEnd       = 53
+	rAccountDownloadEnd = 54
+	rExecutionDataEnd   = 55
+	rCommissionReport   = 59
+	rPosition           = 61
+	rRealtimeBars       = 50
+	rPositionEnd        = 62
+	rAccountSummary     = 63
+	rAccountSummaryEnd  = 64
+)
+
+// serverVersion is reported in the handshake
+const serverVersion = 70
+
+// placeOrderFields lists the PlaceOrder fields following the message version,
+// as written by gofinance/ib for orders without combo legs, algos or hedges.
+var placeOrderFields = []string{
+	"id", "conId", "symbol", "secType", "expiry", "strike", "right", "multiplier",
+	"exchange", "primaryExchange", "currency", "localSymbol", "secIdType", "secId",
+	"action", "totalQty", "orderType", "lmtPrice", "auxPrice",
+	"tif", "ocaGroup", "account", "openClose", "origin", "orderRef", "transmit", "parentId",
+	"blockOrder", "sweepToFill", "displaySize", "triggerMethod", "outsideRth", "hidden",
+	"sharesAllocation", "discretionaryAmt", "goodAfterTime", "goodTillDate",
+	"faGroup", "faMethod", "faPercentage", "faProfile",
+	"shortSaleSlot", "designatedLocation", "exemptCode",
+	"ocaType", "rule80A", "settlingFirm", "allOrNone", "minQty", "percentOffset",
+	"eTradeOnly", "firmQuoteOnly", "nbboPriceCap", "auctionStrategy",
+	"startingPrice", "stockRefPrice", "delta", "stockRangeLower", "stockRangeUpper",
+	"overridePercentageConstraints", "volatility", "volatilityType",
+	"deltaNeutralOrderType", "deltaNeutralAuxPrice",
+	"continuousUpdate", "referencePriceType", "trailStopPrice", "trailingPercent",
+	"scaleInitLevelSize", "scaleSubsLevelSize", "scalePriceIncrement",
+	"scaleTable", "activeStartTime", "activeStopTime",
+	"hedgeType", "optOutSmartRouting", "clearingAccount", "clearingIntent", "notHeld",
+	"underComp", "algoStrategy", "whatIf",
+}
+
+// requestFields is the number of fields following the message code, version included
+var requestFields = map[int]int{
+	mPlaceOrder:             1 + len(placeOrderFields),
+	mCancelOrder:            2,
+	mRequestOpenOrders:      1,
+	mRequestAccountUpdates:  3,
+	mRequestExecutions:      9,
+	mRequestIDs:             2,
+	mRequestContractData:    15,
+	mRequestHistoricalData:  19,
+	mCancelHistoricalData:   2,
+	mRequestAllOpenOrders:   1,
+	mRequestManagedAccounts: 1,
+	mRequestRealTimeBars:    15,
+	mCancelRealTimeBars:     2,
+	mRequestGlobalCancel:    1,
+	mRequestPositions:       1,
+	mRequestAccountSummary:  4,
+	mCancelAccountSummary:   2,
+	mCancelPositions:        1,
+}
+
+// Reply is one message from the gateway, as its wire fields
+type Reply []string
+
+func fields(vals ...interface{}) Reply {
+	r := make(Reply, 0, len(vals))
+	for _, v := range vals {
+		switch v := v.(type) {
+		case string:
+			r = append(r, v)
+		case int:
+			r = append(r, strconv.Itoa(v))
+		case int64:
+			r = append(r, strconv.FormatInt(v, 10))
+		case float64:
+			r = append(r, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			if v {
+				r = append(r, "1")
+			} else {
+				r = append(r, "0")
+			}
+		}
+	}
+	return r
+}
+
+// NextValidID tells the client the first order id it may use
+func NextValidID(id int64) Reply {
+	return fields(rNextValidID, 1, id)
+}
+
+func ManagedAccounts(accounts string) Reply {
+	return fields(rManagedAccounts, 1, accounts)
+}
+
+func ErrorMessage(id int64, code int64, message string) Reply {
+	return fields(rErrorMessage, 2, id, code, message)
+}
+
+func OrderStatus(id int64, status string, filled int64, remaining int64, avgFillPrice float64, parentID int64) Reply {
+	return fields(rOrderStatus, 6, id, status, filled, remaining, avgFillPrice, int64(0), parentID, avgFillPrice, int64(0), "")
+}
+
+// Fill describes one execution for ExecutionData and CommissionReport replies
+type Fill struct {
+	RequestID    int64
+	OrderID      int64
+	ExecID       string
+	Time         time.Time
+	Account      string
+	Symbol       string
+	Side         string
+	Shares       int64
+	Price        float64
+	CumQty       int64
+	AveragePrice float64
+	Exchange     string
+	Commission   float64
+	RealizedPNL  float64
+}
+
+func ExecutionData(f Fill) Reply {
+	return fields(rExecutionData, 9, f.RequestID, f.OrderID,
+		int64(0), f.Symbol, "STK", "", 0.0, "", "", f.Exchange, "USD", f.Symbol,
+		f.ExecID, f.Time.Format("20060102  15:04:05"), f.Account, f.Exchange, f.Side,
+		f.Shares, f.Price, int64(0), int64(0), int64(0), f.CumQty, f.AveragePrice, "", "", "")
+}
+
+func CommissionReport(f Fill) Reply {
+	return fields(rCommissionReport, 1, f.ExecID, f.Commission, "USD", f.RealizedPNL, 0.0, int64(0))
+}
+
+// Listing describes one contract for ContractData replies
+type Listing struct {
+	ContractID   int64
+	Symbol       string
+	SecurityType string
+	Exchange     string
+	Currency     string
+	LongName     string
+	MinTick      float64
+}
+
+func ContractData(requestID int64, l Listing) Reply {
+	return fields(rContractData, 8, requestID,
+		l.Symbol, l.SecurityType, "", 0.0, "", l.Exchange, l.Currency, l.Symbol, l.Symbol, l.Symbol,
+		l.ContractID, l.MinTick, "", "LMT,MKT,STP,TRAIL", l.Exchange, int64(1), int64(0), l.LongName, "NASDAQ",
+		"", "", "", "", "EST", "", "", "", "", int64(0))
+}
+
+func ContractDataEnd(requestID int64) Reply {
+	return fields(rContractDataEnd, 1, requestID)
+}
+
+func ExecutionDataEnd(requestID int64) Reply {
+	return fields(rExecutionDataEnd, 1, requestID)
+}
+
+// Holding describes one position for Position replies
+type Holding struct {
+	Account     string
+	Symbol      string
+	Position    int64
+	AverageCost float64
+}
+
+func Position(h Holding) Reply {
+	return fields(rPosition, 2, h.Account, int64(0), h.Symbol, "STK", "", 0.0, "", "", "SMART", "USD", h.Symbol, h.Position, h.AverageCost)
+}
+
+func PositionEnd() Reply {
+	return fields(rPositionEnd, 1)
+}
+
+func OpenOrderEnd() Reply {
+	return fields(rOpenOrderEnd, 1)
+}
+
+func AccountDownloadEnd(account string) Reply {
+	return fields(rAccountDownloadEnd, 1, account)
+}
+
+// RealtimeBar is one 5 second bar for RealtimeBars replies
+func RealtimeBar(requestID int64, t time.Time, open float64, high float64, low float64, close float64, volume int64) Reply {
+	return fields(rRealtimeBars, 3, requestID, t.Unix(), open, high, low, close, volume, close, int64(1))
+}
+
+// AccountSummary is one tag of the account summary, in USD
+func AccountSummary(requestID int64, account string, tag string, value string) Reply {
+	return fields(rAccountSummary, 1, requestID, account, tag, value, "USD")
+}
+
+// Bar is one daily bar for HistoricalData replies
+type Bar struct {
+	Date   time.Time
+	Open   float64
+	High   float64
+	Low    float64
+	Close  float64
+	Volume int64
+}
+
+// HistoricalData sends daily bars the way TWS formats them with formatDate=1
+func HistoricalData(requestID int64, bars []Bar) Reply {
+	var start, end string
+	if len(bars) > 0 {
+		start = bars[0].Date.Format("20060102  15:04:05")
+		end = bars[len(bars)-1].Date.Format("20060102  15:04:05")
+	}
+	vals := []interface{}{rHistoricalData, 3, requestID, start, end, int64(len(bars))}
+	for _, b := range bars {
+		vals = append(vals, b.Date.Format("20060102"), b.Open, b.High, b.Low, b.Close, b.Volume, b.Close, "false", int64(1))
+	}
+	return fields(vals...)
+}
+
+func AccountSummaryEnd(requestID int64) Reply {
+	return fields(rAccountSummaryEnd, 1, requestID)
+}
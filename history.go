@@ -0,0 +1,231 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/gofinance/ib"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HistoryEntry is one execution kept in the trade history
+type HistoryEntry struct {
+	Label     string
+	ExecID    string
+	Execution ExecutionInfo
+	HasFill   bool
+	Recorded  time.Time
+}
+
+// historyStore keeps every execution seen by any account, across sessions.
+// Entries are appended to the file as JSON lines, a later line for the same
+// ExecID replaces the earlier one when the file is loaded.
+type historyStore struct {
+	mu       sync.Mutex
+	filename string
+	entries  map[string]*HistoryEntry
+}
+
+func loadHistory(filename string) *historyStore {
+	h := &historyStore{
+		filename: filename,
+		entries:  make(map[string]*HistoryEntry),
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return h
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Printf("ERROR reading history %s: %v", filename, err)
+			continue
+		}
+		h.entries[e.ExecID] = &e
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("ERROR reading history %s: %v", filename, err)
+	}
+	return h
+}
+
+// save appends an entry to the history file
+func (h *historyStore) save(e *HistoryEntry) {
+	file, err := os.OpenFile(h.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("ERROR writing history %s: %v", h.filename, err)
+		return
+	}
+	defer file.Close()
+
+	e.Recorded = time.Now()
+	b, err := json.Marshal(e)
+	if err == nil {
+		_, err = file.Write(append(b, '\n'))
+	}
+	if err != nil {
+		log.Printf("ERROR writing history %s: %v", h.filename, err)
+	}
+}
+
+func (h *historyStore) entry(label string, execID string) *HistoryEntry {
+	e, ok := h.entries[execID]
+	if !ok {
+		e = &HistoryEntry{Label: label, ExecID: execID}
+		h.entries[execID] = e
+	}
+	return e
+}
+
+// execution records a fill, ignoring fills already recorded
+func (h *historyStore) execution(label string, r *ib.ExecutionData) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e := h.entry(label, r.Exec.ExecID)
+	if e.HasFill {
+		return
+	}
+	e.Execution.ExecutionData = *r
+	e.HasFill = true
+	h.save(e)
+}
+
+// commission records the commission report of a fill
+func (h *historyStore) commission(label string, r *ib.CommissionReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e := h.entry(label, r.ExecutionID)
+	if e.Execution.Commission == *r {
+		return
+	}
+	e.Execution.Commission = *r
+	h.save(e)
+}
+
+// query returns the fills for the accounts in labels (all when empty), for a
+// symbol (any when empty) executed in [from, to), sorted by time
+func (h *historyStore) query(labels map[string]bool, symbol string, from time.Time, to time.Time) []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var list []HistoryEntry
+	for _, e := range h.entries {
+		if !e.HasFill {
+			continue
+		}
+		x := &e.Execution.ExecutionData
+		if len(labels) > 0 && !labels[e.Label] {
+			continue
+		}
+		if symbol != "" && x.Contract.Symbol != symbol && x.Contract.LocalSymbol != symbol {
+			continue
+		}
+		if !from.IsZero() && x.Exec.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !x.Exec.Time.Before(to) {
+			continue
+		}
+		list = append(list, *e)
+	}
+	sort.Sort(historySlice(list))
+	return list
+}
+
+type historySlice []HistoryEntry
+
+func (p historySlice) Len() int {
+	return len(p)
+}
+
+func (p historySlice) Less(i, j int) bool {
+	return TimeSlice{&p[i].Execution, &p[j].Execution}.Less(0, 1)
+}
+
+func (p historySlice) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+// parseDay reads a YYYY-MM-DD or YYYYMMDD date in local time
+func parseDay(str string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date must be YYYY-MM-DD")
+}
+
+// parseHistoryArgs splits [symbol] [from] [to], where to includes the whole day
+func parseHistoryArgs(strs []string) (symbol string, from time.Time, to time.Time, err error) {
+	if len(strs) > 0 {
+		if _, derr := parseDay(strs[0]); derr != nil {
+			symbol = strs[0]
+			strs = strs[1:]
+		}
+	}
+	if len(strs) > 2 {
+		return "", from, to, fmt.Errorf("usage: history [symbol] [from] [to]")
+	}
+	if len(strs) > 0 {
+		if from, err = parseDay(strs[0]); err != nil {
+			return "", from, to, err
+		}
+	}
+	if len(strs) > 1 {
+		if to, err = parseDay(strs[1]); err != nil {
+			return "", from, to, err
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return symbol, from, to, nil
+}
+
+// historyRecord prints a stored fill, with its date since history spans days
+type historyRecord struct {
+	*executionRecord
+}
+
+func (r historyRecord) kind() string { return "history" }
+
+func (r historyRecord) text(label string) string {
+	return fmt.Sprintf("%s: %s %4d %-7s %s %4d %7.2f %4d %7.2f %6.2f %8.2f %s",
+		label, r.ExecTime.Format("2006-01-02 15:04:05"), r.OrderID, r.Symbol, r.Side, r.Shares, r.Price, r.CumQty, r.AveragePrice, r.Commission, r.RealizedPNL, r.Exchange)
+}
+
+func (r historyRecord) header() []string {
+	return []string{"Date", "Time", "ID", "Symbol", "Side", "Shares", "Price", "CumQty", "AvgPrice", "Comm", "PNL", "Exchange"}
+}
+
+func (r historyRecord) cells() []string {
+	return []string{r.ExecTime.Format("2006-01-02"), r.ExecTime.Format("15:04:05"), fmt.Sprint(r.OrderID), r.Symbol, r.Side,
+		fmt.Sprint(r.Shares), money(r.Price), fmt.Sprint(r.CumQty), money(r.AveragePrice), money(r.Commission), money(r.RealizedPNL), r.Exchange}
+}
@@ -18,24 +18,18 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"github.com/fiorix/go-readline"
 	"github.com/gofinance/ib"
 	"log"
 	"os"
 	"reflect"
-	"sort"
-	"strconv"
 	"strings"
-	"time"
+	"sync"
+	"sync/atomic"
 )
 
-var shownewline bool = false
-var gEnableRTH bool = true
-var gEnableGTC bool = true
-var gUpdateOverride bool = false
-var gCancel bool = true
-
 type ExecutionInfo struct {
 	ExecutionData ib.ExecutionData
 	Commission    ib.CommissionReport
@@ -45,42 +39,110 @@ type IBManager struct {
 	label       string
 	nextOrderid int64
 	engine      *ib.Engine
+	conn        connState
+	// ready is closed once the connection has received a next valid order id
+	ready chan struct{}
+	// done is closed when the account is disconnected on purpose
+	done        chan struct{}
 	opts        ib.EngineOptions
 	paper       bool
+	skipConfirm bool
 	elog        map[string]*ExecutionInfo
 	realtimeMap map[int64]string
+	out         *printer
+	// accountUpdates is set while subscribed to account updates
+	accountUpdates bool
+	settings       Settings
+	contracts      *contractCache
+	atrs           map[string]atrValue
+	history        *historyStore
+	bars           *barStore
+	orders         *orderBook
+	positions      *positionBook
+
+	// whatif makes placeOrders evaluate orders instead of sending them
+	whatif  bool
+	whatifs map[int64]*ib.PlaceOrder
+
+	// batch mode waits for TWS to answer every order placed
+	trackAcks bool
+	acks      []*waiter
+
+	// waiters collect the replies to requests commands are waiting on
+	waiters []*waiter
+
+	confirm func(question string) bool
+
+	// mu guards the maps and settings shared with engineLoop
+	mu sync.Mutex
+}
+
+// Settings are the per account toggles changed from the command line
+type Settings struct {
+	OutsideRTH     bool
+	GTC            bool
+	UpdateOverride bool
+	CancelAccount  bool
+}
+
+func defaultSettings() Settings {
+	return Settings{
+		OutsideRTH:    true,
+		GTC:           true,
+		CancelAccount: true,
+	}
+}
+
+func (m *IBManager) Settings() Settings {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.settings
 }
 
-func NewOrder() (ib.Order, error) {
+func (m *IBManager) NewOrder() (ib.Order, error) {
 	order, err := ib.NewOrder()
+	settings := m.Settings()
 
-	if gEnableRTH {
+	if settings.OutsideRTH {
 		order.OutsideRTH = true
 	}
 
 	order.TIF = "DAY"
-	if gEnableGTC {
+	if settings.GTC {
 		order.TIF = "GTC"
 	}
 
 	return order, err
 }
 
-func NewContract(symbol string) ib.Contract {
-	return ib.Contract{
-		Symbol:       symbol,
-		SecurityType: "STK",
-		Exchange:     "SMART",
-		Currency:     "USD",
+// newOrderWith is NewOrder with the time in force and outside RTH flag
+// replaced when given
+func (m *IBManager) newOrderWith(tif string, outsideRTH *bool) (ib.Order, error) {
+	order, err := m.NewOrder()
+	if tif != "" {
+		order.TIF = tif
+	}
+	if outsideRTH != nil {
+		order.OutsideRTH = *outsideRTH
 	}
+	return order, err
 }
 
-func doBuy(mgr *IBManager, symbol string, quantity uint64, market bool, price float64) {
+func NewContract(symbol string) (ib.Contract, error) {
+	return ParseContract(symbol)
+}
+
+func doBuy(mgr *IBManager, symbol string, quantity uint64, market bool, price float64) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
 	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+		Contract: contract,
 	}
 
-	request.Order, _ = NewOrder()
+	request.Order, _ = mgr.NewOrder()
 	request.Order.Action = "BUY"
 	request.Order.TotalQty = int64(quantity)
 
@@ -92,145 +154,312 @@ func doBuy(mgr *IBManager, symbol string, quantity uint64, market bool, price fl
 	}
 	request.SetID(mgr.NextOrderID())
 
-	mgr.engine.Send(&request)
+	if err := mgr.placeOrders(&request); err != nil {
+		return err
+	}
 	log.Printf("%s: Sending BUY for %s, quantity %v, - %s - %v", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.LimitPrice)
+	return nil
+}
+
+func doSellTrail(mgr *IBManager, symbol string, quantity uint64, trail priceOffset) error {
+	return doTrail(mgr, symbol, quantity, "SELL", trail, "", nil)
 }
 
-func doSellTrail(mgr *IBManager, symbol string, quantity uint64, trailamount float64) {
+func doSellTrailLimit(mgr *IBManager, symbol string, quantity uint64, trailamount float64, stopprice float64, limitoffset float64) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
 	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+		Contract: contract,
 	}
 
-	request.Order, _ = NewOrder()
+	request.Order, _ = mgr.NewOrder()
 	request.Order.Action = "SELL"
 	request.Order.TotalQty = int64(quantity)
-	request.Order.OrderType = "TRAIL"
-	request.Order.AuxPrice = trailamount
+	setTrailLimit(&request.Order, trailamount, stopprice, roundPrice(contract, stopprice-limitoffset))
 	request.SetID(mgr.NextOrderID())
 
-	mgr.engine.Send(&request)
-	log.Printf("%s: Sending SELL for %s, quantity %v, %s - %.2f", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice)
+	if err := mgr.placeOrders(&request); err != nil {
+		return err
+	}
+	log.Printf("%s: Sending SELL for %s, quantity %v, %s - trail:%.2f stop:%.2f", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice, request.Order.TrailStopPrice)
+	return nil
 }
 
-func doSellTrailLimit(mgr *IBManager, symbol string, quantity uint64, trailamount float64, stopprice float64, limitoffset float64) {
-	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+// direction is the side of the position a bracket opens
+type direction int
+
+const (
+	dirLong direction = iota
+	dirShort
+)
+
+// opening is the action of the entry order
+func (d direction) opening() string {
+	if d == dirShort {
+		return "SELL"
 	}
+	return "BUY"
+}
 
-	request.Order, _ = NewOrder()
-	request.Order.Action = "SELL"
-	request.Order.TotalQty = int64(quantity)
-	request.Order.OrderType = "TRAIL LIMIT"
-	request.Order.AuxPrice = trailamount
-	request.Order.TrailStopPrice = stopprice
-	request.Order.LimitPrice = stopprice - limitoffset
-	request.SetID(mgr.NextOrderID())
+// closing is the action of the target and stop orders
+func (d direction) closing() string {
+	if d == dirShort {
+		return "BUY"
+	}
+	return "SELL"
+}
 
-	mgr.engine.Send(&request)
-	log.Printf("%s: Sending SELL for %s, quantity %v, %s - trail:%.2f stop:%.2f", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice, request.Order.TrailStopPrice)
+// sign is 1 when the position gains as the price rises and -1 when it loses
+func (d direction) sign() float64 {
+	if d == dirShort {
+		return -1
+	}
+	return 1
 }
 
-func doBracket(mgr *IBManager, symbol string, quantity uint64, buyprice float64, sellprice float64, stopprice float64) {
+// setTrail makes order a trailing stop, trailing by dollars or a percentage
+func setTrail(order *ib.Order, trail priceOffset) {
+	order.OrderType = "TRAIL"
+	if trail.unit == unitPercent {
+		order.TrailingPercent = trail.value
+	} else {
+		order.AuxPrice = trail.value
+	}
+}
+
+// setTrailLimit makes order a trailing stop limit starting at stopprice
+func setTrailLimit(order *ib.Order, trailamount float64, stopprice float64, limitprice float64) {
+	order.OrderType = "TRAIL LIMIT"
+	order.AuxPrice = trailamount
+	order.TrailStopPrice = stopprice
+	order.LimitPrice = limitprice
+}
+
+// bracketOrder describes the three orders of a bracket
+type bracketOrder struct {
+	Direction  direction
+	Entry      float64
+	EntryType  string // LMT (default) or MKT
+	Target     float64
+	TargetType string // LMT or MIT
+	Stop       float64
+	StopType   string // STP, STP LMT, TRAIL or TRAIL LIMIT
+	// StopLimit is the limit price of a STP LMT or TRAIL LIMIT stop
+	StopLimit float64
+	// Trail is the trailing amount of a TRAIL or TRAIL LIMIT stop, in dollars
+	// or, for TRAIL, a percentage
+	Trail priceOffset
+
+	// TIF and OutsideRTH override the gtc and rth toggles when set
+	TIF        string
+	OutsideRTH *bool
+}
+
+func doBracket(mgr *IBManager, symbol string, quantity uint64, dir direction, entryprice float64, targetprice float64, stopprice float64) error {
+	return placeBracket(mgr, symbol, quantity, bracketOrder{
+		Direction:  dir,
+		Entry:      entryprice,
+		Target:     targetprice,
+		TargetType: "LMT",
+		Stop:       stopprice,
+		StopType:   "STP",
+	})
+}
+
+func placeBracket(mgr *IBManager, symbol string, quantity uint64, b bracketOrder) error {
 	var parentid int64
 
-	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
+	parent := ib.PlaceOrder{
+		Contract: contract,
 	}
 
 	parentid = mgr.NextOrderID()
-	request.SetID(parentid)
-	request.Order, _ = NewOrder()
-	request.Order.Transmit = false
-	request.Order.Action = "BUY"
-	request.Order.TotalQty = int64(quantity)
-	request.Order.OrderType = "LMT"
-	request.Order.LimitPrice = buyprice
+	parent.SetID(parentid)
+	parent.Order, _ = mgr.newOrderWith(b.TIF, b.OutsideRTH)
+	parent.Order.Transmit = false
+	parent.Order.Action = b.Direction.opening()
+	parent.Order.TotalQty = int64(quantity)
+	if b.EntryType == "MKT" {
+		parent.Order.OrderType = "MKT"
+	} else {
+		parent.Order.OrderType = "LMT"
+		parent.Order.LimitPrice = b.Entry
+	}
 
-	mgr.engine.Send(&request)
-	log.Printf("%s: BRK - Sending BUY for %s, quantity %v, - %s - %v", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.LimitPrice)
+	stop := ib.PlaceOrder{
+		Contract: contract,
+	}
 
-	request.SetID(mgr.NextOrderID())
-	request.Order, _ = NewOrder()
-	request.Order.ParentID = parentid
-	request.Order.Transmit = false
+	stop.SetID(mgr.NextOrderID())
+	stop.Order, _ = mgr.newOrderWith(b.TIF, b.OutsideRTH)
+	stop.Order.ParentID = parentid
+	stop.Order.Transmit = false
+
+	stop.Order.Action = b.Direction.closing()
+	stop.Order.TotalQty = int64(quantity)
+	switch b.StopType {
+	case "TRAIL":
+		setTrail(&stop.Order, b.Trail)
+	case "TRAIL LIMIT":
+		setTrailLimit(&stop.Order, b.Trail.value, b.Stop, b.StopLimit)
+	default:
+		stop.Order.OrderType = b.StopType
+		stop.Order.AuxPrice = b.Stop
+		if b.StopType == "STP LMT" {
+			stop.Order.LimitPrice = b.StopLimit
+		}
+	}
 
-	request.Order.Action = "SELL"
-	request.Order.TotalQty = int64(quantity)
-	request.Order.OrderType = "STP"
-	request.Order.AuxPrice = stopprice
+	target := ib.PlaceOrder{
+		Contract: contract,
+	}
 
-	mgr.engine.Send(&request)
-	log.Printf("%s: BRK - Sending STP for %s, quantity %v, - %s - %v", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice)
+	target.SetID(mgr.NextOrderID())
+	target.Order, _ = mgr.newOrderWith(b.TIF, b.OutsideRTH)
+	target.Order.ParentID = parentid
 
-	request.SetID(mgr.NextOrderID())
-	request.Order, _ = NewOrder()
-	request.Order.ParentID = parentid
+	target.Order.Action = b.Direction.closing()
+	target.Order.TotalQty = int64(quantity)
+	target.Order.OrderType = b.TargetType
+	if b.TargetType == "MIT" {
+		target.Order.AuxPrice = b.Target
+	} else {
+		target.Order.LimitPrice = b.Target
+	}
 
-	request.Order.Action = "SELL"
-	request.Order.TotalQty = int64(quantity)
-	request.Order.OrderType = "LMT"
-	request.Order.LimitPrice = sellprice
+	if err := mgr.placeOrders(&parent, &stop, &target); err != nil {
+		return err
+	}
+	log.Printf("%s: BRK - Sending %s for %s, quantity %v, - %s - %v", mgr.label, parent.Order.Action, symbol, quantity, parent.Order.OrderType, parent.Order.LimitPrice)
+	log.Printf("%s: BRK - Sending %s for %s, quantity %v, - %s - %s", mgr.label, stop.Order.Action, symbol, quantity, stop.Order.OrderType, b.stopText())
+	log.Printf("%s: BRK - Sending %s for %s, quantity %v, - %s - %v", mgr.label, target.Order.Action, symbol, quantity, target.Order.OrderType, b.Target)
+	return nil
+}
 
-	mgr.engine.Send(&request)
-	log.Printf("%s: BRK - Sending SELL for %s, quantity %v, - %s - %v", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.LimitPrice)
+// stopText describes the prices of the stop order of a bracket
+func (b bracketOrder) stopText() string {
+	switch b.StopType {
+	case "TRAIL":
+		return fmt.Sprintf("trail:%s", b.Trail)
+	case "TRAIL LIMIT":
+		return fmt.Sprintf("trail:%s stop:%v lmt:%v", b.Trail, b.Stop, b.StopLimit)
+	case "STP LMT":
+		return fmt.Sprintf("stop:%v lmt:%v", b.Stop, b.StopLimit)
+	}
+	return fmt.Sprint(b.Stop)
 }
 
-func doBuyTrail(mgr *IBManager, symbol string, quantity uint64, trailamount float64) {
+// check makes sure the target, stop and stop limit of a bracket are on the
+// right sides of the entry and above zero
+func (b bracketOrder) check() error {
+	if err := checkBracket(b.Direction, b.Entry, b.Target, b.Stop); err != nil {
+		return err
+	}
+	if b.StopType == "STP LMT" || b.StopType == "TRAIL LIMIT" {
+		return checkStopLimit(b.StopLimit)
+	}
+	return nil
+}
+
+// doTrail sends a trailing stop whose trail is a dollar amount, a percentage or a multiple of the ATR
+func doTrail(mgr *IBManager, symbol string, quantity uint64, action string, trail priceOffset, tif string, outsideRTH *bool) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
+	trail, err = mgr.resolveTrail(symbol, trail, 0)
+	if err != nil {
+		return err
+	}
+
 	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+		Contract: contract,
 	}
 
-	request.Order, _ = NewOrder()
-	request.Order.Action = "BUY"
+	request.Order, _ = mgr.newOrderWith(tif, outsideRTH)
+	request.Order.Action = action
 	request.Order.TotalQty = int64(quantity)
-	request.Order.OrderType = "TRAIL"
-	request.Order.AuxPrice = trailamount
+	setTrail(&request.Order, trail)
 	request.SetID(mgr.NextOrderID())
 
-	mgr.engine.Send(&request)
-	log.Printf("%s: Sending BUY for %s, quantity %v, %s - %.2f", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice)
+	if err := mgr.placeOrders(&request); err != nil {
+		return err
+	}
+	log.Printf("%s: Sending %s for %s, quantity %v, %s - %s", mgr.label, action, symbol, quantity, request.Order.OrderType, trail)
+	return nil
+}
+
+func doBuyTrail(mgr *IBManager, symbol string, quantity uint64, trail priceOffset) error {
+	return doTrail(mgr, symbol, quantity, "BUY", trail, "", nil)
 }
 
-func doBuyTrailLimit(mgr *IBManager, symbol string, quantity uint64, trailamount float64, stopprice float64, limitoffset float64) {
+func doBuyTrailLimit(mgr *IBManager, symbol string, quantity uint64, trailamount float64, stopprice float64, limitoffset float64) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
 	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+		Contract: contract,
 	}
 
-	request.Order, _ = NewOrder()
+	request.Order, _ = mgr.NewOrder()
 	request.Order.Action = "BUY"
 	request.Order.TotalQty = int64(quantity)
-	request.Order.OrderType = "TRAIL LIMIT"
-	request.Order.AuxPrice = trailamount
-	request.Order.TrailStopPrice = stopprice
-	request.Order.LimitPrice = stopprice + limitoffset
+	setTrailLimit(&request.Order, trailamount, stopprice, roundPrice(contract, stopprice+limitoffset))
 	request.SetID(mgr.NextOrderID())
 
-	mgr.engine.Send(&request)
+	if err := mgr.placeOrders(&request); err != nil {
+		return err
+	}
 	log.Printf("%s: Sending BUY for %s, quantity %v, %s - trail:%.2f stop:%.2f", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice, request.Order.TrailStopPrice)
+	return nil
 }
 
-func doBuyTrailMarketIfTouched(mgr *IBManager, symbol string, quantity uint64, trailamount float64) {
+func doBuyTrailMarketIfTouched(mgr *IBManager, symbol string, quantity uint64, trailamount float64) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
 	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+		Contract: contract,
 	}
 
-	request.Order, _ = NewOrder()
+	request.Order, _ = mgr.NewOrder()
 	request.Order.Action = "BUY"
 	request.Order.TotalQty = int64(quantity)
 	request.Order.OrderType = "TRAIL MIT"
 	request.Order.AuxPrice = trailamount
 	request.SetID(mgr.NextOrderID())
 
-	mgr.engine.Send(&request)
+	if err := mgr.placeOrders(&request); err != nil {
+		return err
+	}
 	log.Printf("%s: Sending BUY for %s, quantity %v, %s - %.2f", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice)
+	return nil
 }
 
-func doSell(mgr *IBManager, symbol string, quantity uint64, market bool, price float64) {
+func doSell(mgr *IBManager, symbol string, quantity uint64, market bool, price float64) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
 	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+		Contract: contract,
 	}
 
-	request.Order, _ = NewOrder()
+	request.Order, _ = mgr.NewOrder()
 	request.Order.Action = "SELL"
 	request.Order.TotalQty = int64(quantity)
 
@@ -242,16 +471,24 @@ func doSell(mgr *IBManager, symbol string, quantity uint64, market bool, price f
 	}
 	request.SetID(mgr.NextOrderID())
 
-	mgr.engine.Send(&request)
+	if err := mgr.placeOrders(&request); err != nil {
+		return err
+	}
 	log.Printf("%s: Sending SELL for %s, quantity %v, - %s - %v", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.LimitPrice)
+	return nil
 }
 
-func doStopMarket(mgr *IBManager, symbol string, quantity uint64, stopprice float64) {
+func doStopMarket(mgr *IBManager, symbol string, quantity uint64, stopprice float64) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
 	request := ib.PlaceOrder{
-		Contract: NewContract(symbol),
+		Contract: contract,
 	}
 
-	request.Order, _ = NewOrder()
+	request.Order, _ = mgr.NewOrder()
 	request.Order.Action = "SELL"
 	request.Order.TotalQty = int64(quantity)
 	request.Order.OrderType = "STP"
@@ -259,13 +496,21 @@ func doStopMarket(mgr *IBManager, symbol string, quantity uint64, stopprice floa
 
 	request.SetID(mgr.NextOrderID())
 
-	mgr.engine.Send(&request)
+	if err := mgr.placeOrders(&request); err != nil {
+		return err
+	}
 	log.Printf("%s: Sending STP SELL for %s, quantity %v, - %s - %v", mgr.label, symbol, quantity, request.Order.OrderType, request.Order.AuxPrice)
+	return nil
 }
 
-func doRequestRealTimeBars(mgr *IBManager, symbol string) {
+func doRequestRealTimeBars(mgr *IBManager, symbol string) error {
+	contract, err := mgr.resolveContract(symbol)
+	if err != nil {
+		return err
+	}
+
 	request := ib.RequestRealTimeBars{
-		Contract:   NewContract(symbol),
+		Contract:   contract,
 		BarSize:    5,
 		WhatToShow: ib.RealTimeTrades,
 		UseRTH:     true,
@@ -273,18 +518,31 @@ func doRequestRealTimeBars(mgr *IBManager, symbol string) {
 
 	id := mgr.NextOrderID()
 	request.SetID(id)
+	mgr.mu.Lock()
 	mgr.realtimeMap[id] = symbol
+	mgr.mu.Unlock()
 
-	mgr.engine.Send(&request)
+	if err := mgr.send(&request); err != nil {
+		return err
+	}
 
 	log.Printf("%s: Sending RealTime Bars For %s", mgr.label, symbol)
+	return nil
 }
 
+// NextOrderID hands out order ids, safe to call from any goroutine
 func (m *IBManager) NextOrderID() int64 {
-	val := m.nextOrderid
+	return atomic.AddInt64(&m.nextOrderid, 1) - 1
+}
 
-	m.nextOrderid++
-	return val
+// setNextValidID moves the next order id forward, never back over ids already used
+func (m *IBManager) setNextValidID(id int64) {
+	for {
+		cur := atomic.LoadInt64(&m.nextOrderid)
+		if id <= cur || atomic.CompareAndSwapInt64(&m.nextOrderid, cur, id) {
+			return
+		}
+	}
 }
 
 func FloatAdjustValue(val float64) float64 {
@@ -295,27 +553,29 @@ func FloatAdjustValue(val float64) float64 {
 	return val
 }
 
-func engineLoop(ibmanager *IBManager) {
+// engineLoop handles the replies of the current engine until its connection
+// ends.  It returns true when the engine was stopped on purpose.
+func engineLoop(ibmanager *IBManager, engine *ib.Engine, reconnected bool) bool {
 	var engs chan ib.EngineState = make(chan ib.EngineState)
 	var rc chan ib.Reply = make(chan ib.Reply)
 
 	// intialize all subscriptions for messages
-	ibmanager.engine.SubscribeState(engs)
-	ibmanager.engine.SubscribeAll(rc)
+	engine.SubscribeState(engs)
+	engine.SubscribeAll(rc)
 
 	// Get the next order id
-	ibmanager.engine.Send(&ib.RequestIDs{})
-	//ibmanager.engine.Send(&ib.RequestManagedAccounts{})
+	engine.Send(&ib.RequestIDs{})
+	//engine.Send(&ib.RequestManagedAccounts{})
+
+	if reconnected {
+		go ibmanager.resubscribe()
+	}
 
 	for {
 		select {
 		case r := <-rc:
-			if shownewline {
-				//if len(ibmanager.elog) > 0 {
-				//fmt.Printf("\n")
-				//}
-				shownewline = false
-			}
+			// replies a command is waiting for are printed by that command
+			claimed := ibmanager.dispatch(r)
 
 			//log.Printf("%s - RECEIVE %v", ibmanager.label, reflect.TypeOf(r))
 			switch r.(type) {
@@ -323,6 +583,12 @@ func engineLoop(ibmanager *IBManager) {
 			case (*ib.ErrorMessage):
 				r := r.(*ib.ErrorMessage)
 				log.Printf("%s ID: %v Code:%3d Message:'%v'\n", ibmanager.label, r.ID(), r.Code, r.Message)
+				// a rejected what-if gets no OpenOrder, forget it
+				if isOrderError(r.Code) {
+					if _, ok := ibmanager.takeWhatIf(r.ID()); ok {
+						log.Printf("%s: WHATIF %v rejected", ibmanager.label, r.ID())
+					}
+				}
 
 			case (*ib.ManagedAccounts):
 				r := r.(*ib.ManagedAccounts)
@@ -332,17 +598,29 @@ func engineLoop(ibmanager *IBManager) {
 
 			case (*ib.Position):
 				r := r.(*ib.Position)
-				log.Printf("%s: C:%6v P:%10v AvgC:%10.2f\n", ibmanager.label, r.Contract.Symbol, r.Position, r.AverageCost)
+				ibmanager.positions.position(r)
+				if !claimed {
+					ibmanager.out.print(ibmanager.label, newPositionRecord(r))
+				}
 
 			case (*ib.OpenOrder):
 				r := r.(*ib.OpenOrder)
-				commission := FloatAdjustValue(r.OrderState.Commission)
-				maxcommission := FloatAdjustValue(r.OrderState.MaxCommission)
-				mincommission := FloatAdjustValue(r.OrderState.MinCommission)
-				log.Printf("%s OrderID: %v,%v Status: %-9v Symbol: %-5v Action   : %-4v  Quantity        : %4v %v %v l:%6.2f a:%6.2f c:%4.2f %4.2f/%4.2f\n", ibmanager.label, r.Order.OrderID, r.Order.ParentID, r.OrderState.Status, r.Contract.Symbol, r.Order.Action, r.Order.TotalQty, r.Order.TIF, r.Order.OrderType, r.Order.LimitPrice, r.Order.AuxPrice, commission, mincommission, maxcommission)
+				// whatif modify reuses the id of a live order, whose own
+				// OpenOrder replies are not what-if results
+				if r.Order.WhatIf {
+					if request, ok := ibmanager.takeWhatIf(r.Order.OrderID); ok {
+						printWhatIf(ibmanager, request, r.OrderState)
+						break
+					}
+				}
+				ibmanager.orders.openOrder(r)
+				if !claimed {
+					ibmanager.out.print(ibmanager.label, newOpenOrderRecord(r))
+				}
 
 			case (*ib.OrderStatus):
 				r := r.(*ib.OrderStatus)
+				ibmanager.orders.orderStatus(r)
 				log.Printf("%s OrderID: %v,%v Status: %-9v Filled: %5v Remaining: %5v AverageFillPrice: %6.2f - WH:'%s'\n", ibmanager.label, r.ID(), r.ParentID, r.Status, r.Filled, r.Remaining, r.AverageFillPrice, r.WhyHeld)
 
 			case (*ib.AccountValue):
@@ -369,99 +647,85 @@ func engineLoop(ibmanager *IBManager) {
 					default:
 						show = false
 					}
-					if show || gUpdateOverride {
+					if show || ibmanager.Settings().UpdateOverride {
 						log.Printf("%s: K:%-26v V:%20v\n", ibmanager.label, r.Key.Key, r.Value)
 					}
 				}
 
 			case (*ib.PortfolioValue):
 				r := r.(*ib.PortfolioValue)
+				ibmanager.positions.portfolio(r)
 				log.Printf("%s: C:%6v P:%10v AvgC:%10.2f uPNL:%8.2f PNL:%8.2f\n", ibmanager.label, r.Contract.Symbol, r.Position, r.AverageCost, r.UnrealizedPNL, r.RealizedPNL)
 
 			case (*ib.AccountSummary):
 				r := r.(*ib.AccountSummary)
-				log.Printf("%s: K:%-26v V:%20v\n", ibmanager.label, r.Key.Key, r.Value)
+				if !claimed {
+					ibmanager.out.print(ibmanager.label, newSummaryRecord(r))
+				}
 
 			case (*ib.ExecutionData):
 				r := r.(*ib.ExecutionData)
+				ibmanager.positions.execution(r)
+				ibmanager.history.execution(ibmanager.label, r)
+				ibmanager.mu.Lock()
 				item, ok := ibmanager.elog[r.Exec.ExecID]
 				if !ok {
 					item = new(ExecutionInfo)
 					ibmanager.elog[r.Exec.ExecID] = item
 				}
 				item.ExecutionData = *r
+				ibmanager.mu.Unlock()
 
 			case (*ib.CommissionReport):
 				r := r.(*ib.CommissionReport)
+				ibmanager.history.commission(ibmanager.label, r)
+				ibmanager.mu.Lock()
 				item, ok := ibmanager.elog[r.ExecutionID]
 				if !ok {
 					item = new(ExecutionInfo)
 					ibmanager.elog[r.ExecutionID] = item
 				}
 				item.Commission = *r
+				ibmanager.mu.Unlock()
 
 			case (*ib.AccountSummaryEnd):
 				r := r.(*ib.AccountSummaryEnd)
 
-				if gCancel {
+				if ibmanager.Settings().CancelAccount {
 					req := &ib.CancelAccountSummary{}
 					req.SetID(r.ID())
-					ibmanager.engine.Send(req)
+					engine.Send(req)
 				}
 
 			case (*ib.ExecutionDataEnd):
-				var keys TimeSlice
-				for _, k := range ibmanager.elog {
-					keys = append(keys, k)
-				}
-
-				sort.Sort(keys)
-
-				for _, x := range keys {
-					log.Printf("%s: %v %4d %-7s %s %4d %7.2f %4d %7.2f %6.2f %s\n",
-						ibmanager.label,
-						x.ExecutionData.Exec.Time.Format("15:04:05"),
-						x.ExecutionData.Exec.OrderID,
-						x.ExecutionData.Contract.Symbol,
-						x.ExecutionData.Exec.Side,
-						x.ExecutionData.Exec.Shares,
-						x.ExecutionData.Exec.Price,
-						x.ExecutionData.Exec.CumQty,
-						x.ExecutionData.Exec.AveragePrice,
-						x.Commission.Commission,
-						x.ExecutionData.Exec.Exchange)
-				}
 
 			case (*ib.RealtimeBars):
 				r := r.(*ib.RealtimeBars)
 
+				ibmanager.mu.Lock()
 				symbol, ok := ibmanager.realtimeMap[r.ID()]
+				ibmanager.mu.Unlock()
 				if !ok {
 					symbol = ""
 				}
 
-				log.Printf("%10s: %v - Open: %10.2f Close: %10.2f Low %10.2f High %10.2f Volume %10.2f Count %10v WAP %10.2f\n",
-					symbol,
-					time.Unix(r.Time, 0).Format("15:04:05"),
-					r.Open,
-					r.Close,
-					r.Low,
-					r.High,
-					r.Volume,
-					r.Count,
-					r.WAP)
+				ibmanager.bars.add(symbol, r)
+				ibmanager.out.print(ibmanager.label, newBarRecord(symbol, r))
 
 			case (*ib.PositionEnd):
 
 			case (*ib.AccountDownloadEnd):
-				if gCancel {
+				if ibmanager.Settings().CancelAccount {
+					ibmanager.setAccountUpdates(false)
 					req := &ib.RequestAccountUpdates{}
 					req.Subscribe = false
-					ibmanager.engine.Send(req)
+					engine.Send(req)
 				}
 
 			case (*ib.OpenOrderEnd):
 
+			case (*ib.ContractData):
+
 			case (*ib.ContractDataEnd):
 
 			case (*ib.TickSnapshotEnd):
@@ -470,7 +734,8 @@ func engineLoop(ibmanager *IBManager) {
 
 			case (*ib.NextValidID):
 				r := r.(*ib.NextValidID)
-				ibmanager.nextOrderid = r.OrderID
+				ibmanager.setNextValidID(r.OrderID)
+				ibmanager.setReady()
 
 			default:
 				log.Printf("%s - RECEIVE %v", ibmanager.label, reflect.TypeOf(r))
@@ -478,29 +743,74 @@ func engineLoop(ibmanager *IBManager) {
 			}
 		case newstate := <-engs:
 			log.Printf("%s ERROR: %v\n", ibmanager.label, newstate)
-			if newstate != ib.EngineExitNormal {
-				log.Fatalf("%s ERROR: %v", ibmanager.label, ibmanager.engine.FatalError())
+			if newstate == ib.EngineExitNormal {
+				return true
 			}
-			return
+			log.Printf("%s ERROR: %v", ibmanager.label, engine.FatalError())
+			return false
 		}
 	}
 }
 
 type applyManagerFunc func(*IBManager) error
 
-func applyFunc(empty bool, acctselect string, accts []*IBManager, applyFn applyManagerFunc) {
+// reportedError is an error already logged with the account it happened in
+type reportedError struct {
+	error
+}
+
+// applyFunc runs applyFn on the selected accounts, logging each account's
+// error and returning the first
+func applyFunc(empty bool, acctselect string, accts []*IBManager, applyFn applyManagerFunc) error {
 	if !empty && acctselect == "" {
-		fmt.Println("Must select an account to buy/sell")
-		return
+		return fmt.Errorf("must select an account to buy/sell")
 	}
+	var first error
 	for _, ac := range accts {
 		if acctselect == "" || ac.label == acctselect {
-			_ = applyFn(ac)
+			if err := applyFn(ac); err != nil {
+				log.Printf("%s: %v", ac.label, err)
+				if first == nil {
+					first = reportedError{err}
+				}
+			}
 		}
 	}
+	return first
 }
 
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	script := flag.String("f", "", "run the commands in `file` (- for stdin) and exit")
+	commands := flag.String("c", "", "run the ';' separated `commands` and exit")
+	outputFlag := flag.String("output", "text", "print results as `text`, table or json")
+	flag.Parse()
+
+	format, err := parseFormat(*outputFlag)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return 2
+	}
+	out := newPrinter(format)
+
+	var batch []string
+	switch {
+	case *script != "":
+		batch, err = readBatchFile(*script)
+		if err != nil {
+			log.Printf("ERROR reading %s: %v", *script, err)
+			return 2
+		}
+	case *commands != "":
+		batch, err = readBatch(strings.NewReader(*commands))
+		if err != nil {
+			log.Printf("ERROR reading -c commands: %v", err)
+			return 2
+		}
+	}
 
 	// Output TWS messages to a separate file and use a split screen terminal to show them.
 	if false {
@@ -518,46 +828,63 @@ func main() {
 	config, cerr := LoadConfigFromFile("config.js")
 	if cerr != nil {
 		log.Fatalf("ERROR loading initial config %v", cerr)
-		return
+		return 1
 	}
 
+	contracts := loadContractCache("contracts.json")
+	history := loadHistory("history.json")
+	bars := newBarStore()
+
 	acct := make([]*IBManager, 0)
 	for _, a := range config.Accounts {
 		log.Printf("SETUP: %s %v", a.Label, a.Paper)
 		acct = append(acct, &IBManager{
-			label: a.Label,
-			paper: a.Paper,
+			label:       a.Label,
+			paper:       a.Paper,
+			skipConfirm: a.SkipConfirm,
 			opts: ib.EngineOptions{
 				Gateway: a.Gateway,
 				Client:  a.Client,
 			},
 			elog:        make(map[string]*ExecutionInfo),
 			realtimeMap: make(map[int64]string),
+			settings:    defaultSettings(),
+			contracts:   contracts,
+			history:     history,
+			bars:        bars,
+			orders:      newOrderBook(),
+			positions:   newPositionBook(),
+			whatifs:     make(map[int64]*ib.PlaceOrder),
+			confirm:     confirm,
+			out:         out,
 		})
 	}
 
 	for _, ac := range acct {
-		var err error
-		ac.engine, err = ib.NewEngine(ac.opts)
-		if err != nil {
-			log.Fatalf("error creating %s Engine %v ", ac.label, err)
+		if err := ac.start(); err != nil {
+			log.Printf("%s: not connected: %v", ac.label, err)
 		}
-		defer ac.engine.Stop()
-		if ac.engine.State() != ib.EngineReady {
-			log.Fatalf("%s engine is not ready", ac.label)
-		}
-		go engineLoop(ac)
+		defer ac.stop()
 	}
 
-	time.Sleep(1 * time.Second)
+	s, err := newSession(acct, out, config.presets())
+	if err != nil {
+		log.Printf("ERROR %v", err)
+		return 1
+	}
 
-	acctselect := ""
-	prompt := "> "
+	if batch != nil {
+		if err := s.runBatch(batch); err != nil {
+			return 1
+		}
+		return 0
+	}
 
-	// Loop until Readline returns nil (signalling EOF)
-	lastresult := ""
-L:
-	for {
+	readline.SetCompletionFunction(s.complete)
+
+	// Loop until the exit command
+	for !s.quit {
+		prompt := s.prompt()
 		result := readline.Readline(&prompt)
 		if result == nil {
 			fmt.Println()
@@ -565,423 +892,24 @@ L:
 		}
 
 		// prevent duplicate calls
-		if *result == lastresult {
+		if *result == s.lastresult {
 			continue
 		}
 
-		lastresult = *result
-		strs := strings.Fields(strings.TrimSpace(*result))
+		s.lastresult = *result
+		line := strings.TrimSpace(*result)
 
-		if len(strs) == 0 {
+		if line == "" {
 			continue
 		}
 
-		if *result != "" {
-			readline.AddHistory(*result)
-		}
-
-		command := strs[0]
-
-		switch {
-		case command == "exit":
-			break L // exit loop
-		case command == "quit":
-			break L // exit loop
-
-		case command == "summary":
-			lastresult = ""
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				reqAs := &ib.RequestAccountSummary{}
-				reqAs.SetID(ac.engine.NextRequestID())
-				reqAs.Group = "All"
-				reqAs.Tags = "BuyingPower,NetLiquidation,GrossPositionValue,TotalCashValue,SettledCash,InitMarginReq,MaintMarginReq,AvailableFunds,TotalCashValue,UnrealizedPnL"
-				ac.engine.Send(reqAs)
-				shownewline = true
-				return nil
-			})
-
-		case command == "open":
-			lastresult = ""
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				ac.engine.Send(&ib.RequestOpenOrders{})
-				shownewline = true
-				return nil
-			})
-
-		case command == "positions":
-			lastresult = ""
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				req := &ib.RequestPositions{}
-				ac.engine.Send(req)
-				shownewline = true
-				return nil
-			})
-
-		case command == "updates":
-			lastresult = ""
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				req := &ib.RequestAccountUpdates{}
-				req.Subscribe = true
-				ac.engine.Send(req)
-				shownewline = true
-				return nil
-			})
-
-		case command == "noupdates":
-			lastresult = ""
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				req := &ib.RequestAccountUpdates{}
-				req.Subscribe = false
-				ac.engine.Send(req)
-				return nil
-			})
-
-		case command == "elog":
-			lastresult = ""
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				ac.elog = make(map[string]*ExecutionInfo)
-				ereq := ib.RequestExecutions{}
-				ereq.SetID(ac.engine.NextRequestID())
-				ac.engine.Send(&ereq)
-				shownewline = true
-				return nil
-			})
-
-		case command == "select":
-			lastresult = ""
-			if len(strs) != 2 {
-				fmt.Printf("select <label|all>\n")
-				continue
-			}
-			if strs[1] == "all" {
-				acctselect = ""
-				prompt = "> "
-			} else {
-				for _, ac := range acct {
-					if ac.label == strs[1] {
-						acctselect = ac.label
-						prompt = acctselect + " > "
-						break
-					}
-				}
-			}
-
-		case command == "sell-t":
-			if len(strs) != 4 {
-				fmt.Printf("sell-t <symbol> <quantity> <trailamount>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			trailamount, _ := strconv.ParseFloat(strs[3], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doSellTrail(ac, strs[1], quantity, trailamount)
-				shownewline = true
-				return nil
-			})
-
-		case command == "sell-tl":
-			if len(strs) != 6 {
-				fmt.Printf("sell-tl <symbol> <quantity> <stopprice> <trailamount> <limitoffset>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			stopprice, _ := strconv.ParseFloat(strs[3], 64)
-			trailamount, _ := strconv.ParseFloat(strs[4], 64)
-			limitoffset, _ := strconv.ParseFloat(strs[5], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doSellTrailLimit(ac, strs[1], quantity, trailamount, stopprice, limitoffset)
-				shownewline = true
-				return nil
-			})
-
-		case command == "sell-l":
-			if len(strs) != 4 {
-				fmt.Printf("sell-l <symbol> <quantity> <limitprice>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			limitprice, _ := strconv.ParseFloat(strs[3], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doSell(ac, strs[1], quantity, false, limitprice)
-				shownewline = true
-				return nil
-			})
-
-		case command == "sell-m":
-			if len(strs) != 3 {
-				fmt.Printf("sell-m <symbol> <quantity>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doSell(ac, strs[1], quantity, true, 0)
-				shownewline = true
-				return nil
-			})
+		readline.AddHistory(*result)
 
-		case command == "buy-t":
-			if len(strs) != 4 {
-				fmt.Printf("buy-t <symbol> <quantity> <trailamount>\n")
-				continue
+		if err := s.execute(line); err != nil {
+			if _, ok := err.(reportedError); !ok {
+				log.Printf("ERROR %v", err)
 			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			trailamount, _ := strconv.ParseFloat(strs[3], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBuyTrail(ac, strs[1], quantity, trailamount)
-				shownewline = true
-				return nil
-			})
-
-		case command == "buy-if":
-			if len(strs) != 4 {
-				fmt.Printf("buy-if <symbol> <quantity> <trailamount>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			trailamount, _ := strconv.ParseFloat(strs[3], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBuyTrailMarketIfTouched(ac, strs[1], quantity, trailamount)
-				shownewline = true
-				return nil
-			})
-
-		case command == "buy-tl":
-			if len(strs) != 6 {
-				fmt.Printf("buy-tl <symbol> <quantity> <stopprice> <trailamount> <limitoffset>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			stopprice, _ := strconv.ParseFloat(strs[3], 64)
-			trailamount, _ := strconv.ParseFloat(strs[4], 64)
-			limitoffset, _ := strconv.ParseFloat(strs[5], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBuyTrailLimit(ac, strs[1], quantity, trailamount, stopprice, limitoffset)
-				shownewline = true
-				return nil
-			})
-
-		case command == "buy-l":
-			if len(strs) != 4 {
-				fmt.Printf("buy-l <symbol> <quantity> <limitprice>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			limitprice, _ := strconv.ParseFloat(strs[3], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBuy(ac, strs[1], quantity, false, limitprice)
-				shownewline = true
-				return nil
-			})
-
-		case command == "buy-m":
-			if len(strs) != 3 {
-				fmt.Printf("buy-m <symbol> <quantity>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBuy(ac, strs[1], quantity, true, 0)
-				shownewline = true
-				return nil
-			})
-
-		case command == "bracket":
-			if len(strs) != 6 {
-				fmt.Printf("bracket <symbol> <quantity> <buyprice> <sellprice> <stopprice>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			buyprice, _ := strconv.ParseFloat(strs[3], 64)
-			sellprice, _ := strconv.ParseFloat(strs[4], 64)
-			stopprice, _ := strconv.ParseFloat(strs[5], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBracket(ac, strs[1], quantity, buyprice, sellprice, stopprice)
-				shownewline = true
-				return nil
-			})
-
-		case command == "brka":
-			if len(strs) != 6 {
-				fmt.Printf("brka <symbol> <quantity> <buyprice> <selloff> <stopoff>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			buyprice, _ := strconv.ParseFloat(strs[3], 64)
-			sellprice, _ := strconv.ParseFloat(strs[4], 64)
-			stopprice, _ := strconv.ParseFloat(strs[5], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBracket(ac, strs[1], quantity, buyprice, buyprice+sellprice, buyprice-stopprice)
-				shownewline = true
-				return nil
-			})
-
-		case command == "brkp1":
-			if len(strs) != 4 {
-				fmt.Printf("brkp1 <symbol> <quantity> <buyprice> {sell = buy + 0.20, stp = buy - 0.05} \n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			buyprice, _ := strconv.ParseFloat(strs[3], 64)
-			sellprice := buyprice + 0.20
-			stopprice := buyprice - 0.05
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBracket(ac, strs[1], quantity, buyprice, sellprice, stopprice)
-				shownewline = true
-				return nil
-			})
-
-		case command == "brkp2":
-			if len(strs) != 4 {
-				fmt.Printf("brkp2 <symbol> <quantity> <buyprice> {sell = buy + 0.11, stp = buy - 0.05} \n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			buyprice, _ := strconv.ParseFloat(strs[3], 64)
-			sellprice := buyprice + 0.11
-			stopprice := buyprice - 0.05
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doBracket(ac, strs[1], quantity, buyprice, sellprice, stopprice)
-				shownewline = true
-				return nil
-			})
-
-		case command == "stop-m":
-			if len(strs) != 4 {
-				fmt.Printf("stop-m <symbol> <quantity> <stopprice>\n")
-				continue
-			}
-
-			quantity, _ := strconv.ParseUint(strs[2], 10, 64)
-			stopprice, _ := strconv.ParseFloat(strs[3], 64)
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doStopMarket(ac, strs[1], quantity, stopprice)
-				shownewline = true
-				return nil
-			})
-
-		case command == "override":
-			if len(strs) != 2 {
-				fmt.Printf("override status %v\n", gUpdateOverride)
-				continue
-			}
-
-			if strs[1] == "on" {
-				gUpdateOverride = true
-			} else {
-				gUpdateOverride = false
-			}
-			fmt.Printf("override %v\n", gUpdateOverride)
-		case command == "rth":
-			if len(strs) != 2 {
-				fmt.Printf("rth status %v\n", gEnableRTH)
-				continue
-			}
-
-			if strs[1] == "on" {
-				gEnableRTH = true
-			} else {
-				gEnableRTH = false
-			}
-			fmt.Printf("rth status %v\n", gEnableRTH)
-
-		case command == "gtc":
-			if len(strs) != 2 {
-				fmt.Printf("gtc status %v\n", gEnableGTC)
-				continue
-			}
-
-			if strs[1] == "on" {
-				gEnableGTC = true
-			} else {
-				gEnableGTC = false
-			}
-			fmt.Printf("gtc status %v\n", gEnableGTC)
-
-		case command == "acct-cancel":
-			if len(strs) != 2 {
-				fmt.Printf("acct-cancel status %v\n", gCancel)
-				continue
-			}
-
-			if strs[1] == "on" {
-				gCancel = true
-			} else {
-				gCancel = false
-			}
-			fmt.Printf("acct-cancel status %v\n", gCancel)
-
-		case command == "realtimebar":
-			if len(strs) != 2 {
-				fmt.Printf("realtimebar <symbol>\n")
-				continue
-			}
-
-			applyFunc(false, acctselect, acct, func(ac *IBManager) error {
-				doRequestRealTimeBars(ac, strs[1])
-				return nil
-			})
-
-		case command == "cancel":
-			lastresult = ""
-			if len(strs) != 2 {
-				fmt.Printf("cancel <orderid>\n")
-				continue
-			}
-			orderid := int64(0)
-			if strs[1] != "all" {
-				orderid, _ = strconv.ParseInt(strs[1], 10, 64)
-			}
-
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				if strs[1] == "all" {
-					ac.engine.Send(&ib.RequestGlobalCancel{})
-				} else {
-					request := ib.CancelOrder{}
-					request.SetID(orderid)
-					ac.engine.Send(&request)
-					shownewline = true
-				}
-				return nil
-			})
-
-		case command == "cancelall":
-			lastresult = ""
-
-			applyFunc(true, acctselect, acct, func(ac *IBManager) error {
-				ac.engine.Send(&ib.RequestGlobalCancel{})
-				shownewline = true
-				return nil
-			})
-
-		case command != "": // Ignore blank lines
-			fmt.Println(*result)
 		}
 	}
+	return 0
 }
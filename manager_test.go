@@ -0,0 +1,251 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"github.com/dsouzae/ibstockcli/fakegw"
+	"github.com/gofinance/ib"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestManager connects a paper account to a fake gateway
+func newTestManager(t *testing.T, label string, gateway string, client int64) *IBManager {
+	dir := t.TempDir()
+	out := newPrinter(formatJSON)
+	out.out = ioutil.Discard
+
+	m := &IBManager{
+		label: label,
+		paper: true,
+		opts: ib.EngineOptions{
+			Gateway: gateway,
+			Client:  client,
+		},
+		elog:        make(map[string]*ExecutionInfo),
+		realtimeMap: make(map[int64]string),
+		settings:    defaultSettings(),
+		contracts:   loadContractCache(filepath.Join(dir, "contracts.json")),
+		history:     loadHistory(filepath.Join(dir, "history.json")),
+		bars:        newBarStore(),
+		orders:      newOrderBook(),
+		positions:   newPositionBook(),
+		whatifs:     make(map[int64]*ib.PlaceOrder),
+		confirm:     func(string) bool { return true },
+		out:         out,
+	}
+	if err := m.start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.stop)
+	if err := m.waitReady(readyTimeout); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestManagersConcurrently hands out order ids, resets the execution log,
+// subscribes to bars and flips toggles from several goroutines while TWS
+// replies stream in.  Run it with -race.
+func TestManagersConcurrently(t *testing.T) {
+	s, err := fakegw.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.SetNextValidID(1000)
+
+	accts := []*IBManager{
+		newTestManager(t, "ib1", s.Addr(), 1),
+		newTestManager(t, "ib2", s.Addr(), 2),
+	}
+
+	const (
+		idWorkers = 4
+		idsEach   = 50
+		rounds    = 5
+	)
+
+	rth := newCommands().find("rth")
+	on, err := rth.parse([]string{"on"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, err := rth.parse([]string{"off"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ids := make([][]int64, len(accts))
+
+	for i, ac := range accts {
+		i, ac := i, ac
+		for w := 0; w < idWorkers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for n := 0; n < idsEach; n++ {
+					id := ac.NextOrderID()
+					mu.Lock()
+					ids[i] = append(ids[i], id)
+					mu.Unlock()
+				}
+			}()
+		}
+
+		wg.Add(4)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < rounds; n++ {
+				if err := doBuy(ac, "AAPL", 10, true, 0); err != nil {
+					t.Errorf("%s: buy: %v", ac.label, err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := 0; n < rounds; n++ {
+				if _, err := ac.Executions(); err != nil {
+					t.Errorf("%s: executions: %v", ac.label, err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := 0; n < rounds; n++ {
+				if err := doRequestRealTimeBars(ac, "AAPL"); err != nil {
+					t.Errorf("%s: realtime bars: %v", ac.label, err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 4*rounds; n++ {
+				a := on
+				if n%2 == 1 {
+					a = off
+				}
+				if err := rth.apply(ac, a); err != nil {
+					t.Errorf("%s: rth: %v", ac.label, err)
+				}
+				ac.Settings()
+			}
+		}()
+	}
+
+	// account downloads make engineLoop read the toggles and change the subscription
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 4*rounds; n++ {
+			s.Broadcast(fakegw.AccountDownloadEnd(s.Account))
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	wg.Wait()
+
+	for i, ac := range accts {
+		seen := make(map[int64]bool)
+		for _, id := range ids[i] {
+			if seen[id] {
+				t.Errorf("%s: order id %v handed out twice", ac.label, id)
+			}
+			seen[id] = true
+		}
+		if len(seen) != idWorkers*idsEach {
+			t.Errorf("%s: %d distinct order ids, want %d", ac.label, len(seen), idWorkers*idsEach)
+		}
+
+		ac.mu.Lock()
+		subscriptions := len(ac.realtimeMap)
+		ac.mu.Unlock()
+		if subscriptions != rounds {
+			t.Errorf("%s: %d realtime bar subscriptions, want %d", ac.label, subscriptions, rounds)
+		}
+
+		execs, err := ac.Executions()
+		if err != nil {
+			t.Fatalf("%s: executions: %v", ac.label, err)
+		}
+		if want := len(accts) * rounds; len(execs) != want {
+			t.Errorf("%s: %d executions, want %d", ac.label, len(execs), want)
+		}
+	}
+}
+
+// TestRiskQuantity sizes an order from the funds the fake gateway reports
+func TestRiskQuantity(t *testing.T) {
+	s, err := fakegw.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ac := newTestManager(t, "ib1", s.Addr(), 1)
+
+	// 1% of 100000 at 2.00 risk a share
+	quantity, err := ac.riskQuantity("AAPL", riskAmount{value: 1, percent: true}, 100, 98)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quantity != 500 {
+		t.Errorf("quantity %v, want 500", quantity)
+	}
+
+	// capped by the 50000 of available funds
+	quantity, err = ac.riskQuantity("AAPL", riskAmount{value: 5000}, 100, 99)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quantity != 500 {
+		t.Errorf("quantity %v, want 500 after the cap", quantity)
+	}
+}
+
+// TestATR works out the ATR from the fake gateway's daily bars, which are
+// 2.00 from low to high every day
+func TestATR(t *testing.T) {
+	s, err := fakegw.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ac := newTestManager(t, "ib1", s.Addr(), 1)
+
+	atr, err := ac.ATR("AAPL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(atr-2) > 1e-9 {
+		t.Errorf("ATR %v, want 2", atr)
+	}
+
+	trail, err := ac.resolveTrail("AAPL", priceOffset{value: 1.5, unit: unitATR}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trail.value != 3 || trail.unit != unitDollars {
+		t.Errorf("1.5atr trail is %v", trail)
+	}
+}
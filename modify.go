@@ -0,0 +1,218 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"log"
+	"strings"
+)
+
+// orderChanges are the fields given to modify, nil when left alone
+type orderChanges struct {
+	quantity   *uint64
+	limitPrice *float64
+	auxPrice   *float64
+	trailStop  *float64
+}
+
+// parseChanges reads qty=N lmt=P aux=P trail=P pairs
+func parseChanges(strs []string) (orderChanges, error) {
+	var changes orderChanges
+	for _, str := range strs {
+		kv := strings.SplitN(str, "=", 2)
+		if len(kv) != 2 {
+			return changes, fmt.Errorf("invalid change '%s': expected name=value", str)
+		}
+
+		arg := cmdArg{name: kv[0], kind: argPrice}
+		if kv[0] == "qty" {
+			arg.kind = argQuantity
+		}
+		val, err := parseArg(arg, kv[1])
+		if err != nil {
+			return changes, fmt.Errorf("invalid %s '%s': %v", kv[0], kv[1], err)
+		}
+
+		switch kv[0] {
+		case "qty":
+			quantity := val.(uint64)
+			changes.quantity = &quantity
+		case "lmt":
+			price := val.(float64)
+			changes.limitPrice = &price
+		case "aux":
+			price := val.(float64)
+			changes.auxPrice = &price
+		case "trail":
+			price := val.(float64)
+			changes.trailStop = &price
+		default:
+			return changes, fmt.Errorf("unknown change '%s', expected qty, lmt, aux or trail", kv[0])
+		}
+	}
+
+	if len(strs) == 0 {
+		return changes, fmt.Errorf("nothing to modify")
+	}
+	return changes, nil
+}
+
+// checkTicks applies the US equity tick size to new prices of an order on a
+// US stock, checking the trailing amount of trailing orders as an offset
+func (c orderChanges) checkTicks(e OrderEntry) error {
+	if !usesCentTicks(e.Contract) {
+		return nil
+	}
+	check := func(name string, price *float64) error {
+		if price == nil {
+			return nil
+		}
+		if err := checkTick(*price); err != nil {
+			return fmt.Errorf("invalid %s '%v': %v", name, *price, err)
+		}
+		return nil
+	}
+
+	if err := check("lmt", c.limitPrice); err != nil {
+		return err
+	}
+	if err := check("trail", c.trailStop); err != nil {
+		return err
+	}
+	if c.auxPrice != nil && strings.HasPrefix(e.OrderType, "TRAIL") {
+		if err := checkTickSize(*c.auxPrice, offsetTick(e.TrailStopPrice)); err != nil {
+			return fmt.Errorf("invalid aux '%v': %v", *c.auxPrice, err)
+		}
+		return nil
+	}
+	return check("aux", c.auxPrice)
+}
+
+// children returns the working orders attached to a parent order
+func (b *orderBook) children(parentid int64) []OrderEntry {
+	var children []OrderEntry
+	for _, e := range b.list() {
+		if e.ParentID == parentid && !e.Done() {
+			children = append(children, e)
+		}
+	}
+	return children
+}
+
+// modifyRequest rebuilds the request for an order we know about, which needs
+// the full order and not just its status
+func modifyRequest(e OrderEntry) (ib.PlaceOrder, error) {
+	if e.order.Action == "" || e.order.OrderType == "" {
+		return ib.PlaceOrder{}, fmt.Errorf("order %v is only known from its status, use open to load it from TWS", e.OrderID)
+	}
+	request := ib.PlaceOrder{
+		Contract: e.Contract,
+		Order:    e.order,
+	}
+	request.SetID(e.OrderID)
+	request.Order.OrderID = e.OrderID
+	request.Order.Transmit = true
+	return request, nil
+}
+
+// modifyRequests builds the requests that resend a working order with the same
+// id and new fields.  When the order is the parent of a bracket a new quantity
+// is passed on to the children and a new limit price moves the children by the
+// same amount, keeping their offsets.
+func modifyRequests(orders *orderBook, orderid int64, changes orderChanges) ([]*ib.PlaceOrder, error) {
+	e, ok := orders.get(orderid)
+	if !ok {
+		return nil, fmt.Errorf("order %v is unknown, use open to load orders from TWS", orderid)
+	}
+	if e.Done() {
+		return nil, fmt.Errorf("order %v is %s", orderid, e.Status)
+	}
+
+	parent, err := modifyRequest(e)
+	if err != nil {
+		return nil, err
+	}
+	if err := changes.checkTicks(e); err != nil {
+		return nil, err
+	}
+	if changes.quantity != nil {
+		parent.Order.TotalQty = int64(*changes.quantity)
+	}
+	if changes.limitPrice != nil {
+		parent.Order.LimitPrice = *changes.limitPrice
+	}
+	if changes.auxPrice != nil {
+		parent.Order.AuxPrice = *changes.auxPrice
+	}
+	if changes.trailStop != nil {
+		parent.Order.TrailStopPrice = *changes.trailStop
+	}
+
+	requests := []*ib.PlaceOrder{&parent}
+
+	shift := 0.0
+	if changes.limitPrice != nil && e.LimitPrice != 0 {
+		shift = *changes.limitPrice - e.LimitPrice
+	}
+	for _, child := range orders.children(orderid) {
+		if changes.quantity == nil && shift == 0 {
+			break
+		}
+		request, err := modifyRequest(child)
+		if err != nil {
+			return nil, err
+		}
+		if changes.quantity != nil {
+			request.Order.TotalQty = int64(*changes.quantity)
+		}
+		if shift != 0 {
+			if request.Order.LimitPrice != 0 {
+				request.Order.LimitPrice = roundPrice(child.Contract, request.Order.LimitPrice+shift)
+			}
+			switch request.Order.OrderType {
+			case "STP", "STP LMT", "MIT":
+				// stops and market-if-touched targets trigger at their aux price
+				request.Order.AuxPrice = roundPrice(child.Contract, request.Order.AuxPrice+shift)
+			case "TRAIL LIMIT":
+				// the stop moves with its limit, the trailing amount stays
+				if request.Order.TrailStopPrice != 0 {
+					request.Order.TrailStopPrice = roundPrice(child.Contract, request.Order.TrailStopPrice+shift)
+				}
+			}
+		}
+		requests = append(requests, &request)
+	}
+	return requests, nil
+}
+
+// doModify resends a working order and the bracket children that move with it
+func doModify(mgr *IBManager, orderid int64, changes orderChanges) error {
+	requests, err := modifyRequests(mgr.orders, orderid, changes)
+	if err != nil {
+		return err
+	}
+	if err := mgr.placeOrders(requests...); err != nil {
+		return err
+	}
+	for _, r := range requests {
+		log.Printf("%s: MODIFY order %v %s %s, quantity %v, - %s - l:%v a:%v t:%v", mgr.label, r.ID(), r.Order.Action, r.Contract.Symbol, r.Order.TotalQty, r.Order.OrderType, r.Order.LimitPrice, r.Order.AuxPrice, r.Order.TrailStopPrice)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"github.com/gofinance/ib"
+	"math"
+	"testing"
+)
+
+func TestModifyChecksTicks(t *testing.T) {
+	stock, _ := ParseContract("AAPL")
+	future, _ := ParseContract("ES:FUT:202612:GLOBEX")
+
+	tests := []struct {
+		changes []string
+		entry   OrderEntry
+		ok      bool
+	}{
+		{[]string{"lmt=150.12"}, OrderEntry{Contract: stock, OrderType: "LMT"}, true},
+		{[]string{"lmt=150.123"}, OrderEntry{Contract: stock, OrderType: "LMT"}, false},
+		{[]string{"lmt=0.1234"}, OrderEntry{Contract: stock, OrderType: "LMT"}, true},
+		{[]string{"aux=149.995"}, OrderEntry{Contract: stock, OrderType: "STP"}, false},
+		{[]string{"trail=150.001"}, OrderEntry{Contract: stock, OrderType: "TRAIL LIMIT"}, false},
+		// the aux of a trailing order is the trailing amount
+		{[]string{"aux=0.5"}, OrderEntry{Contract: stock, OrderType: "TRAIL", TrailStopPrice: 150}, true},
+		{[]string{"aux=0.005"}, OrderEntry{Contract: stock, OrderType: "TRAIL", TrailStopPrice: 150}, false},
+		{[]string{"aux=0.005"}, OrderEntry{Contract: stock, OrderType: "TRAIL", TrailStopPrice: 0.5}, true},
+		{[]string{"qty=10"}, OrderEntry{Contract: stock, OrderType: "LMT"}, true},
+		// only US stocks are held to the cent
+		{[]string{"lmt=6000.125"}, OrderEntry{Contract: future, OrderType: "LMT"}, true},
+	}
+
+	for _, tt := range tests {
+		changes, err := parseChanges(tt.changes)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.changes, err)
+		}
+		err = changes.checkTicks(tt.entry)
+		if (err == nil) != tt.ok {
+			t.Errorf("%v on %s %s: error %v, want ok %v", tt.changes, tt.entry.Contract.Symbol, tt.entry.OrderType, err, tt.ok)
+		}
+	}
+}
+
+// TestModifyShiftsBracket moves a bracket's entry and checks that a stop and an
+// MIT target, which keeps its trigger in the aux price, move with it
+func TestModifyShiftsBracket(t *testing.T) {
+	stock, _ := ParseContract("AAPL")
+	orders := newOrderBook()
+	place := func(id int64, o ib.Order) {
+		r := &ib.PlaceOrder{Contract: stock, Order: o}
+		r.SetID(id)
+		orders.placed(r)
+	}
+	place(10, ib.Order{Action: "BUY", OrderType: "LMT", TotalQty: 100, LimitPrice: 150})
+	place(11, ib.Order{Action: "SELL", OrderType: "STP", TotalQty: 100, AuxPrice: 145, ParentID: 10})
+	place(12, ib.Order{Action: "SELL", OrderType: "MIT", TotalQty: 100, AuxPrice: 160, ParentID: 10})
+
+	changes, err := parseChanges([]string{"lmt=150.5", "qty=200"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests, err := modifyRequests(orders, 10, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 3 {
+		t.Fatalf("%d requests, want 3", len(requests))
+	}
+
+	want := []struct {
+		id    int64
+		limit float64
+		aux   float64
+	}{
+		{10, 150.5, 0},
+		{11, 0, 145.5},
+		{12, 0, 160.5},
+	}
+	for i, w := range want {
+		o := requests[i].Order
+		if requests[i].ID() != w.id || math.Abs(o.LimitPrice-w.limit) > 1e-9 || math.Abs(o.AuxPrice-w.aux) > 1e-9 || o.TotalQty != 200 {
+			t.Errorf("order %v %s is l:%v a:%v q:%v, want order %v l:%v a:%v q:200", requests[i].ID(), o.OrderType, o.LimitPrice, o.AuxPrice, o.TotalQty, w.id, w.limit, w.aux)
+		}
+	}
+}
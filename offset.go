@@ -0,0 +1,161 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type offsetUnit int
+
+const (
+	unitDollars offsetUnit = iota
+	unitPercent
+	unitATR
+)
+
+// priceOffset is a distance from a price, in dollars, as a percentage of the
+// price or as a multiple of the contract's average true range
+type priceOffset struct {
+	value float64
+	unit  offsetUnit
+}
+
+// parseOffset reads 0.20, 1.5% or 2atr
+func parseOffset(str string) (priceOffset, error) {
+	var o priceOffset
+	lower := strings.ToLower(str)
+	switch {
+	case strings.HasSuffix(lower, "%"):
+		o.unit = unitPercent
+		str = strings.TrimSuffix(lower, "%")
+	case strings.HasSuffix(lower, "atr"):
+		o.unit = unitATR
+		str = strings.TrimSuffix(lower, "atr")
+	}
+
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) {
+		return o, fmt.Errorf("not a number, percentage or ATR multiple")
+	}
+	if val < 0 {
+		return o, fmt.Errorf("must not be negative")
+	}
+	if o.unit == unitPercent && val >= 100 {
+		return o, fmt.Errorf("must be less than 100%%")
+	}
+	o.value = val
+	return o, nil
+}
+
+func (o priceOffset) String() string {
+	switch o.unit {
+	case unitPercent:
+		return fmt.Sprintf("%g%%", o.value)
+	case unitATR:
+		return fmt.Sprintf("%gatr", o.value)
+	}
+	return fmt.Sprintf("%.2f", o.value)
+}
+
+func (o priceOffset) zero() bool {
+	return o.value == 0
+}
+
+// dollars is the size of the offset at price, given the ATR for offsets in ATRs
+func (o priceOffset) dollars(price float64, atr float64) float64 {
+	switch o.unit {
+	case unitPercent:
+		return price * o.value / 100
+	case unitATR:
+		return atr * o.value
+	}
+	return o.value
+}
+
+// needsATR tells whether any of the offsets is in ATRs
+func needsATR(offsets ...priceOffset) bool {
+	for _, o := range offsets {
+		if o.unit == unitATR {
+			return true
+		}
+	}
+	return false
+}
+
+// atrFor fetches the ATR of a symbol when one of the offsets is in ATRs
+func (m *IBManager) atrFor(symbol string, offsets ...priceOffset) (float64, error) {
+	if !needsATR(offsets...) {
+		return 0, nil
+	}
+	return m.ATR(symbol)
+}
+
+// bracketPrices works out the target and stop of a bracket from their offsets to the entry price
+func bracketPrices(symbol string, dir direction, entryprice float64, targetoff priceOffset, stopoff priceOffset, atr float64) (float64, float64) {
+	target := entryprice + dir.sign()*targetoff.dollars(entryprice, atr)
+	stop := entryprice - dir.sign()*stopoff.dollars(entryprice, atr)
+	return roundTick(symbol, target), roundTick(symbol, stop)
+}
+
+// resolveTrail turns a trailing amount in ATRs into dollars, leaving
+// dollars and percentages, which TWS trails by itself, as they are.
+// refprice is the price the trail starts near, 0 when not known.
+func (m *IBManager) resolveTrail(symbol string, trail priceOffset, refprice float64) (priceOffset, error) {
+	if trail.unit != unitATR {
+		return trail, nil
+	}
+	atr, err := m.ATR(symbol)
+	if err != nil {
+		return trail, err
+	}
+	return priceOffset{value: roundOffset(symbol, trail.dollars(0, atr), refprice)}, nil
+}
+
+// stopOffsets works out the trail and limit offset of a trailing stop limit from
+// their offsets to the stop price
+func (m *IBManager) stopOffsets(symbol string, stopprice float64, trail priceOffset, limit priceOffset) (float64, float64, error) {
+	atr, err := m.atrFor(symbol, trail, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+	return roundOffset(symbol, trail.dollars(stopprice, atr), stopprice), roundOffset(symbol, limit.dollars(stopprice, atr), stopprice), nil
+}
+
+// roundTick rounds a computed price to the tick size when the contract trades in cents
+func roundTick(symbol string, price float64) float64 {
+	contract, err := ParseContract(symbol)
+	if err != nil {
+		return price
+	}
+	return roundPrice(contract, price)
+}
+
+// roundOffset rounds a computed distance between prices to the tick of the
+// price it is taken from, or to the cent when that price is not known, which
+// is a valid step at any price
+func roundOffset(symbol string, offset float64, refprice float64) float64 {
+	contract, err := ParseContract(symbol)
+	if err != nil || !usesCentTicks(contract) {
+		return offset
+	}
+	return roundToTick(offset, offsetTick(refprice))
+}
@@ -0,0 +1,116 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseOffset(t *testing.T) {
+	tests := []struct {
+		str  string
+		want priceOffset
+		ok   bool
+	}{
+		{"0.20", priceOffset{value: 0.20, unit: unitDollars}, true},
+		{"1.5%", priceOffset{value: 1.5, unit: unitPercent}, true},
+		{"2atr", priceOffset{value: 2, unit: unitATR}, true},
+		{"0.5ATR", priceOffset{value: 0.5, unit: unitATR}, true},
+		{"0", priceOffset{}, true},
+		{"99.9%", priceOffset{value: 99.9, unit: unitPercent}, true},
+		{"100%", priceOffset{}, false},
+		{"-0.20", priceOffset{}, false},
+		{"-1atr", priceOffset{}, false},
+		{"abc", priceOffset{}, false},
+		{"%", priceOffset{}, false},
+		{"atr", priceOffset{}, false},
+		{"NaN", priceOffset{}, false},
+		{"Inf", priceOffset{}, false},
+		{"", priceOffset{}, false},
+	}
+
+	for _, tt := range tests {
+		o, err := parseOffset(tt.str)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: error %v, want ok %v", tt.str, err, tt.ok)
+			continue
+		}
+		if tt.ok && o != tt.want {
+			t.Errorf("%q is %+v, want %+v", tt.str, o, tt.want)
+		}
+	}
+}
+
+func TestOffsetDollars(t *testing.T) {
+	tests := []struct {
+		offset priceOffset
+		price  float64
+		atr    float64
+		want   float64
+	}{
+		{priceOffset{value: 0.20, unit: unitDollars}, 150, 3, 0.20},
+		{priceOffset{value: 1.5, unit: unitPercent}, 200, 3, 3},
+		{priceOffset{value: 2, unit: unitATR}, 150, 1.25, 2.5},
+	}
+	for _, tt := range tests {
+		if got := tt.offset.dollars(tt.price, tt.atr); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s at %v with atr %v is %v, want %v", tt.offset, tt.price, tt.atr, got, tt.want)
+		}
+	}
+}
+
+func TestOffsetTick(t *testing.T) {
+	tests := []struct {
+		refprice float64
+		want     float64
+	}{
+		{150, 0.01},
+		{1, 0.01},
+		{0.5, 0.0001},
+		// not known, a cent is a valid step at any price
+		{0, 0.01},
+		{-1, 0.01},
+	}
+	for _, tt := range tests {
+		if got := offsetTick(tt.refprice); got != tt.want {
+			t.Errorf("offsetTick(%v) is %v, want %v", tt.refprice, got, tt.want)
+		}
+	}
+}
+
+func TestRoundOffset(t *testing.T) {
+	tests := []struct {
+		symbol   string
+		offset   float64
+		refprice float64
+		want     float64
+	}{
+		{"AAPL", 0.3337, 150, 0.33},
+		{"AAPL", 0.5005, 150, 0.5},
+		{"AAPL", 0.12345, 0.8, 0.1235},
+		{"AAPL", 0.12345, 0, 0.12},
+		// futures are left alone
+		{"ES:FUT:202612:GLOBEX", 0.3337, 6000, 0.3337},
+	}
+	for _, tt := range tests {
+		if got := roundOffset(tt.symbol, tt.offset, tt.refprice); got != tt.want {
+			t.Errorf("roundOffset(%s, %v, %v) is %v, want %v", tt.symbol, tt.offset, tt.refprice, got, tt.want)
+		}
+	}
+}
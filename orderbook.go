@@ -0,0 +1,187 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OrderEntry is what we know about one order, from our own requests and from TWS
+type OrderEntry struct {
+	OrderID        int64
+	Contract       ib.Contract
+	Action         string
+	OrderType      string
+	TotalQty       int64
+	LimitPrice     float64
+	AuxPrice       float64
+	TrailStopPrice float64
+	TIF            string
+	OutsideRTH     bool
+	ParentID       int64
+	Status         string
+	Filled         int64
+	Remaining      int64
+	AvgFillPrice   float64
+	Updated        time.Time
+
+	// order is the last full order sent or reported, for modify
+	order ib.Order
+}
+
+// Done tells whether the order can no longer fill
+func (e *OrderEntry) Done() bool {
+	switch e.Status {
+	case "Filled", "Cancelled", "ApiCancelled", "Inactive":
+		return true
+	}
+	return false
+}
+
+type orderBook struct {
+	mu     sync.Mutex
+	orders map[int64]*OrderEntry
+}
+
+func newOrderBook() *orderBook {
+	return &orderBook{orders: make(map[int64]*OrderEntry)}
+}
+
+func (b *orderBook) entry(id int64) *OrderEntry {
+	e, ok := b.orders[id]
+	if !ok {
+		e = &OrderEntry{OrderID: id}
+		b.orders[id] = e
+	}
+	return e
+}
+
+func (e *OrderEntry) setOrder(contract ib.Contract, o *ib.Order) {
+	e.order = *o
+	e.Contract = contract
+	e.Action = o.Action
+	e.OrderType = o.OrderType
+	e.TotalQty = o.TotalQty
+	e.LimitPrice = o.LimitPrice
+	e.AuxPrice = o.AuxPrice
+	e.TrailStopPrice = o.TrailStopPrice
+	e.TIF = o.TIF
+	e.OutsideRTH = o.OutsideRTH
+	e.ParentID = o.ParentID
+}
+
+// placed records an order we just sent
+func (b *orderBook) placed(r *ib.PlaceOrder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.entry(r.ID())
+	e.setOrder(r.Contract, &r.Order)
+	if e.Status == "" {
+		e.Status = "Sent"
+		e.Remaining = r.Order.TotalQty
+	}
+	e.Updated = time.Now()
+}
+
+func (b *orderBook) openOrder(r *ib.OpenOrder) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.entry(r.Order.OrderID)
+	e.setOrder(r.Contract, &r.Order)
+	e.Status = r.OrderState.Status
+	e.Updated = time.Now()
+}
+
+func (b *orderBook) orderStatus(r *ib.OrderStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.entry(r.ID())
+	e.Status = r.Status
+	e.Filled = r.Filled
+	e.Remaining = r.Remaining
+	e.AvgFillPrice = r.AverageFillPrice
+	if r.ParentID != 0 {
+		e.ParentID = r.ParentID
+	}
+	e.Updated = time.Now()
+}
+
+// get returns a copy of one order
+func (b *orderBook) get(id int64) (OrderEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e, ok := b.orders[id]
+	if !ok {
+		return OrderEntry{}, false
+	}
+	return *e, true
+}
+
+// list returns a copy of every order sorted by id
+func (b *orderBook) list() []OrderEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []OrderEntry
+	for _, e := range b.orders {
+		entries = append(entries, *e)
+	}
+	sort.Sort(orderSlice(entries))
+	return entries
+}
+
+type orderSlice []OrderEntry
+
+func (p orderSlice) Len() int           { return len(p) }
+func (p orderSlice) Less(i, j int) bool { return p[i].OrderID < p[j].OrderID }
+func (p orderSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+func printOrders(out *printer, accts []*IBManager, working bool) {
+	if out.Format() == formatJSON {
+		for _, ac := range accts {
+			for _, e := range ac.orders.list() {
+				if !working || !e.Done() {
+					out.json("order", ac.label, e)
+				}
+			}
+		}
+		return
+	}
+
+	fmt.Printf("%-6s %6s %6s %-12s %-8s %-4s %-11s %6s %6s %6s %9s %9s %9s %-3s %s\n",
+		"Acct", "ID", "Parent", "Status", "Symbol", "Act", "Type", "Qty", "Filled", "Remain", "Limit", "Aux", "AvgFill", "TIF", "Updated")
+	for _, ac := range accts {
+		for _, e := range ac.orders.list() {
+			if working && e.Done() {
+				continue
+			}
+			fmt.Printf("%-6s %6d %6d %-12s %-8s %-4s %-11s %6d %6d %6d %9.2f %9.2f %9.2f %-3s %s\n",
+				ac.label, e.OrderID, e.ParentID, e.Status, e.Contract.Symbol, e.Action, e.OrderType,
+				e.TotalQty, e.Filled, e.Remaining, e.LimitPrice, e.AuxPrice, e.AvgFillPrice, e.TIF,
+				e.Updated.Format("15:04:05"))
+		}
+	}
+}
@@ -0,0 +1,361 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofinance/ib"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+type outputFormat int
+
+const (
+	formatText outputFormat = iota
+	formatTable
+	formatJSON
+)
+
+func (f outputFormat) String() string {
+	switch f {
+	case formatText:
+		return "text"
+	case formatTable:
+		return "table"
+	case formatJSON:
+		return "json"
+	}
+	return "unknown"
+}
+
+func parseFormat(str string) (outputFormat, error) {
+	switch str {
+	case "text":
+		return formatText, nil
+	case "table":
+		return formatTable, nil
+	case "json":
+		return formatJSON, nil
+	}
+	return formatText, fmt.Errorf("output format must be text, table or json")
+}
+
+// record is one result, printed as a log line, a table row or a JSON object
+type record interface {
+	kind() string
+	text(label string) string
+	header() []string
+	cells() []string
+}
+
+// printer writes results in the selected format.  JSON objects are written
+// one per line to stdout, with the log lines left on stderr.
+type printer struct {
+	mu     sync.Mutex
+	format outputFormat
+	out    io.Writer
+	// last is the kind of the last table printed, its header is not repeated
+	last string
+}
+
+func newPrinter(format outputFormat) *printer {
+	return &printer{
+		format: format,
+		out:    os.Stdout,
+	}
+}
+
+func (p *printer) Format() outputFormat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.format
+}
+
+func (p *printer) SetFormat(format outputFormat) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.format = format
+	p.last = ""
+}
+
+// print writes the records for an account
+func (p *printer) print(label string, recs ...record) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.format {
+	case formatText:
+		for _, r := range recs {
+			log.Print(r.text(label))
+		}
+
+	case formatTable:
+		tw := tabwriter.NewWriter(p.out, 10, 8, 1, ' ', 0)
+		for _, r := range recs {
+			if r.kind() != p.last {
+				fmt.Fprintf(tw, "Acct\t%s\n", strings.Join(r.header(), "\t"))
+				p.last = r.kind()
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", label, strings.Join(r.cells(), "\t"))
+		}
+		tw.Flush()
+
+	case formatJSON:
+		for _, r := range recs {
+			p.writeJSON(r.kind(), label, r)
+		}
+	}
+}
+
+// json writes any value as a JSON object, used by the tables that have no text form
+func (p *printer) json(kind string, label string, v interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writeJSON(kind, label, v)
+}
+
+// writeJSON flattens v into one object with its type, account and time
+func (p *printer) writeJSON(kind string, label string, v interface{}) {
+	obj := make(map[string]interface{})
+	if b, err := json.Marshal(v); err == nil {
+		json.Unmarshal(b, &obj)
+	}
+	obj["Type"] = kind
+	obj["Account"] = label
+	obj["Time"] = time.Now().Format(time.RFC3339Nano)
+
+	b, err := json.Marshal(obj)
+	if err != nil {
+		log.Printf("%s: %v", label, err)
+		return
+	}
+	p.out.Write(append(b, '\n'))
+}
+
+func money(val float64) string {
+	return fmt.Sprintf("%.2f", val)
+}
+
+type summaryRecord struct {
+	Key      string
+	Value    string
+	Currency string
+}
+
+func newSummaryRecord(r *ib.AccountSummary) *summaryRecord {
+	return &summaryRecord{
+		Key:      r.Key.Key,
+		Value:    r.Value,
+		Currency: r.Currency,
+	}
+}
+
+func (r *summaryRecord) kind() string { return "summary" }
+
+func (r *summaryRecord) text(label string) string {
+	return fmt.Sprintf("%s: K:%-26v V:%20v", label, r.Key, r.Value)
+}
+
+func (r *summaryRecord) header() []string { return []string{"Key", "Value", "Currency"} }
+
+func (r *summaryRecord) cells() []string { return []string{r.Key, r.Value, r.Currency} }
+
+type positionRecord struct {
+	Symbol       string
+	SecurityType string
+	Currency     string
+	Position     int64
+	AverageCost  float64
+}
+
+func newPositionRecord(r *ib.Position) *positionRecord {
+	return &positionRecord{
+		Symbol:       r.Contract.Symbol,
+		SecurityType: r.Contract.SecurityType,
+		Currency:     r.Contract.Currency,
+		Position:     r.Position,
+		AverageCost:  r.AverageCost,
+	}
+}
+
+func (r *positionRecord) kind() string { return "position" }
+
+func (r *positionRecord) text(label string) string {
+	return fmt.Sprintf("%s: C:%6v P:%10v AvgC:%10.2f", label, r.Symbol, r.Position, r.AverageCost)
+}
+
+func (r *positionRecord) header() []string {
+	return []string{"Symbol", "Type", "Position", "AvgCost"}
+}
+
+func (r *positionRecord) cells() []string {
+	return []string{r.Symbol, r.SecurityType, fmt.Sprint(r.Position), money(r.AverageCost)}
+}
+
+type openOrderRecord struct {
+	OrderID       int64
+	ParentID      int64
+	Status        string
+	Symbol        string
+	Action        string
+	Quantity      int64
+	TIF           string
+	OrderType     string
+	LimitPrice    float64
+	AuxPrice      float64
+	Commission    float64
+	MinCommission float64
+	MaxCommission float64
+}
+
+func newOpenOrderRecord(r *ib.OpenOrder) *openOrderRecord {
+	return &openOrderRecord{
+		OrderID:       r.Order.OrderID,
+		ParentID:      r.Order.ParentID,
+		Status:        r.OrderState.Status,
+		Symbol:        r.Contract.Symbol,
+		Action:        r.Order.Action,
+		Quantity:      r.Order.TotalQty,
+		TIF:           r.Order.TIF,
+		OrderType:     r.Order.OrderType,
+		LimitPrice:    r.Order.LimitPrice,
+		AuxPrice:      r.Order.AuxPrice,
+		Commission:    FloatAdjustValue(r.OrderState.Commission),
+		MinCommission: FloatAdjustValue(r.OrderState.MinCommission),
+		MaxCommission: FloatAdjustValue(r.OrderState.MaxCommission),
+	}
+}
+
+func (r *openOrderRecord) kind() string { return "open_order" }
+
+func (r *openOrderRecord) text(label string) string {
+	return fmt.Sprintf("%s OrderID: %v,%v Status: %-9v Symbol: %-5v Action   : %-4v  Quantity        : %4v %v %v l:%6.2f a:%6.2f c:%4.2f %4.2f/%4.2f", label, r.OrderID, r.ParentID, r.Status, r.Symbol, r.Action, r.Quantity, r.TIF, r.OrderType, r.LimitPrice, r.AuxPrice, r.Commission, r.MinCommission, r.MaxCommission)
+}
+
+func (r *openOrderRecord) header() []string {
+	return []string{"ID", "Parent", "Status", "Symbol", "Act", "Qty", "TIF", "Type", "Limit", "Aux", "Comm"}
+}
+
+func (r *openOrderRecord) cells() []string {
+	return []string{fmt.Sprint(r.OrderID), fmt.Sprint(r.ParentID), r.Status, r.Symbol, r.Action, fmt.Sprint(r.Quantity),
+		r.TIF, r.OrderType, money(r.LimitPrice), money(r.AuxPrice), money(r.Commission)}
+}
+
+type executionRecord struct {
+	ExecID        string
+	ExecTime      time.Time
+	AccountNumber string
+	OrderID       int64
+	Symbol        string
+	SecurityType  string
+	Currency      string
+	Side          string
+	Shares        int64
+	Price         float64
+	CumQty        int64
+	AveragePrice  float64
+	Commission    float64
+	RealizedPNL   float64
+	Exchange      string
+}
+
+func newExecutionRecord(x *ExecutionInfo) *executionRecord {
+	e := &x.ExecutionData.Exec
+	return &executionRecord{
+		ExecID:        e.ExecID,
+		ExecTime:      e.Time,
+		AccountNumber: e.Account,
+		OrderID:       e.OrderID,
+		Symbol:        x.ExecutionData.Contract.Symbol,
+		SecurityType:  x.ExecutionData.Contract.SecurityType,
+		Currency:      x.ExecutionData.Contract.Currency,
+		Side:          e.Side,
+		Shares:        e.Shares,
+		Price:         e.Price,
+		CumQty:        e.CumQty,
+		AveragePrice:  e.AveragePrice,
+		Commission:    x.Commission.Commission,
+		RealizedPNL:   FloatAdjustValue(x.Commission.RealizedPNL),
+		Exchange:      e.Exchange,
+	}
+}
+
+func (r *executionRecord) kind() string { return "execution" }
+
+func (r *executionRecord) text(label string) string {
+	return fmt.Sprintf("%s: %v %4d %-7s %s %4d %7.2f %4d %7.2f %6.2f %s",
+		label, r.ExecTime.Format("15:04:05"), r.OrderID, r.Symbol, r.Side, r.Shares, r.Price, r.CumQty, r.AveragePrice, r.Commission, r.Exchange)
+}
+
+func (r *executionRecord) header() []string {
+	return []string{"Time", "ID", "Symbol", "Side", "Shares", "Price", "CumQty", "AvgPrice", "Comm", "Exchange"}
+}
+
+func (r *executionRecord) cells() []string {
+	return []string{r.ExecTime.Format("15:04:05"), fmt.Sprint(r.OrderID), r.Symbol, r.Side, fmt.Sprint(r.Shares), money(r.Price),
+		fmt.Sprint(r.CumQty), money(r.AveragePrice), money(r.Commission), r.Exchange}
+}
+
+type barRecord struct {
+	Symbol  string
+	BarTime time.Time
+	Open    float64
+	High    float64
+	Low     float64
+	Close   float64
+	Volume  float64
+	Count   int64
+	WAP     float64
+}
+
+func newBarRecord(symbol string, r *ib.RealtimeBars) *barRecord {
+	return &barRecord{
+		Symbol:  symbol,
+		BarTime: time.Unix(r.Time, 0),
+		Open:    r.Open,
+		High:    r.High,
+		Low:     r.Low,
+		Close:   r.Close,
+		Volume:  r.Volume,
+		Count:   r.Count,
+		WAP:     r.WAP,
+	}
+}
+
+func (r *barRecord) kind() string { return "bar" }
+
+func (r *barRecord) text(label string) string {
+	return fmt.Sprintf("%10s: %v - Open: %10.2f Close: %10.2f Low %10.2f High %10.2f Volume %10.2f Count %10v WAP %10.2f",
+		r.Symbol, r.BarTime.Format("15:04:05"), r.Open, r.Close, r.Low, r.High, r.Volume, r.Count, r.WAP)
+}
+
+func (r *barRecord) header() []string {
+	return []string{"Symbol", "Time", "Open", "High", "Low", "Close", "Volume", "Count", "WAP"}
+}
+
+func (r *barRecord) cells() []string {
+	return []string{r.Symbol, r.BarTime.Format("15:04:05"), money(r.Open), money(r.High), money(r.Low), money(r.Close),
+		fmt.Sprint(r.Volume), fmt.Sprint(r.Count), money(r.WAP)}
+}
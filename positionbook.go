@@ -0,0 +1,253 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PositionEntry is the holding of one contract in one account
+type PositionEntry struct {
+	Symbol        string
+	Contract      ib.Contract
+	Position      int64
+	AverageCost   float64 // per contract, multiplier included, as TWS reports it
+	MarketPrice   float64 // per share
+	MarketValue   float64
+	UnrealizedPNL float64
+	RealizedPNL   float64
+	Updated       time.Time
+
+	// snapshot is when TWS last reported the whole position
+	snapshot time.Time
+}
+
+// positionKey names a contract in the position book
+func positionKey(c ib.Contract) string {
+	if c.LocalSymbol != "" {
+		return c.LocalSymbol
+	}
+	return c.Symbol
+}
+
+type positionBook struct {
+	mu        sync.Mutex
+	positions map[string]*PositionEntry
+	seen      map[string]bool
+}
+
+func newPositionBook() *positionBook {
+	return &positionBook{
+		positions: make(map[string]*PositionEntry),
+		seen:      make(map[string]bool),
+	}
+}
+
+func (b *positionBook) entry(c ib.Contract) *PositionEntry {
+	key := positionKey(c)
+	e, ok := b.positions[key]
+	if !ok {
+		e = &PositionEntry{Symbol: key, Contract: c}
+		b.positions[key] = e
+	}
+	return e
+}
+
+// revalue recomputes market value and unrealized PnL from the last market price
+func (e *PositionEntry) revalue() {
+	if e.MarketPrice == 0 {
+		return
+	}
+	value := e.MarketPrice * multiplier(e.Contract)
+	e.MarketValue = value * float64(e.Position)
+	e.UnrealizedPNL = (value - e.AverageCost) * float64(e.Position)
+}
+
+func (b *positionBook) position(r *ib.Position) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.entry(r.Contract)
+	e.Position = r.Position
+	e.AverageCost = r.AverageCost
+	e.revalue()
+	e.Updated = time.Now()
+	e.snapshot = e.Updated
+}
+
+func (b *positionBook) portfolio(r *ib.PortfolioValue) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := b.entry(r.Contract)
+	e.Position = r.Position
+	e.AverageCost = r.AverageCost
+	e.MarketPrice = r.MarketPrice
+	e.MarketValue = r.MarketValue
+	e.UnrealizedPNL = r.UnrealizedPNL
+	e.RealizedPNL = r.RealizedPNL
+	e.Updated = time.Now()
+	e.snapshot = e.Updated
+}
+
+// execution applies a fill that happened after the last snapshot of the position
+func (b *positionBook) execution(r *ib.ExecutionData) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.seen[r.Exec.ExecID] {
+		return
+	}
+	b.seen[r.Exec.ExecID] = true
+
+	e := b.entry(r.Contract)
+	if r.Exec.Time.Before(e.snapshot) {
+		return
+	}
+
+	shares := r.Exec.Shares
+	if r.Exec.Side == "SLD" {
+		shares = -shares
+	}
+	// the cost of one contract, comparable with AverageCost
+	cost := r.Exec.Price * multiplier(r.Contract)
+
+	switch {
+	case e.Position == 0 || (e.Position > 0) == (shares > 0):
+		// opening or adding to the position
+		total := e.AverageCost*float64(e.Position) + cost*float64(shares)
+		e.Position += shares
+		e.AverageCost = total / float64(e.Position)
+	default:
+		// closing some or all of the position
+		closed := shares
+		if abs64(shares) > abs64(e.Position) {
+			closed = -e.Position
+		}
+		e.RealizedPNL += (e.AverageCost - cost) * float64(closed)
+		e.Position += shares
+		if e.Position == 0 {
+			e.AverageCost = 0
+		} else if closed != shares {
+			// flipped to the other side at the fill price
+			e.AverageCost = cost
+		}
+	}
+
+	e.MarketPrice = r.Exec.Price
+	e.revalue()
+	e.Updated = time.Now()
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// list returns a copy of every position sorted by symbol
+func (b *positionBook) list() []PositionEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var entries []PositionEntry
+	for _, e := range b.positions {
+		entries = append(entries, *e)
+	}
+	sort.Sort(positionSlice(entries))
+	return entries
+}
+
+type positionSlice []PositionEntry
+
+func (p positionSlice) Len() int           { return len(p) }
+func (p positionSlice) Less(i, j int) bool { return p[i].Symbol < p[j].Symbol }
+func (p positionSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+const positionFormat = "%-6s %-10s %10d %10.2f %10.2f %12.2f %10.2f %10.2f\n"
+
+// printPositions shows every account's positions with a combined line per
+// symbol held in more than one account, and totals across everything
+func printPositions(out *printer, accts []*IBManager) {
+	if out.Format() == formatJSON {
+		for _, ac := range accts {
+			for _, e := range ac.positions.list() {
+				if e.Position != 0 || e.RealizedPNL != 0 {
+					out.json("portfolio", ac.label, e)
+				}
+			}
+		}
+		return
+	}
+
+	type holding struct {
+		label string
+		entry PositionEntry
+	}
+	bySymbol := make(map[string][]holding)
+	var symbols []string
+
+	for _, ac := range accts {
+		for _, e := range ac.positions.list() {
+			if e.Position == 0 && e.RealizedPNL == 0 {
+				continue
+			}
+			if _, ok := bySymbol[e.Symbol]; !ok {
+				symbols = append(symbols, e.Symbol)
+			}
+			bySymbol[e.Symbol] = append(bySymbol[e.Symbol], holding{ac.label, e})
+		}
+	}
+	sort.Strings(symbols)
+
+	fmt.Printf("%-6s %-10s %10s %10s %10s %12s %10s %10s\n", "Acct", "Symbol", "Position", "AvgCost", "Price", "MktValue", "uPNL", "PNL")
+
+	var value, unrealized, realized float64
+	for _, symbol := range symbols {
+		var total PositionEntry
+		var cost float64
+		for _, h := range bySymbol[symbol] {
+			e := h.entry
+			fmt.Printf(positionFormat, h.label, e.Symbol, e.Position, e.AverageCost, e.MarketPrice, e.MarketValue, e.UnrealizedPNL, e.RealizedPNL)
+
+			total.Position += e.Position
+			cost += e.AverageCost * float64(e.Position)
+			total.MarketPrice = e.MarketPrice
+			total.MarketValue += e.MarketValue
+			total.UnrealizedPNL += e.UnrealizedPNL
+			total.RealizedPNL += e.RealizedPNL
+		}
+		if total.Position != 0 {
+			total.AverageCost = cost / float64(total.Position)
+		}
+		if len(bySymbol[symbol]) > 1 {
+			fmt.Printf(positionFormat, "all", symbol, total.Position, total.AverageCost, total.MarketPrice, total.MarketValue, total.UnrealizedPNL, total.RealizedPNL)
+		}
+
+		value += total.MarketValue
+		unrealized += total.UnrealizedPNL
+		realized += total.RealizedPNL
+	}
+
+	fmt.Printf("%-6s %-10s %10s %10s %10s %12.2f %10.2f %10.2f\n", "total", "", "", "", "", value, unrealized, realized)
+}
@@ -0,0 +1,208 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseOffset parses one of the offsets of a preset, which is zero when left out
+func (p *Preset) parseOffset(field string, str string, required bool) (priceOffset, error) {
+	if str == "" {
+		if required {
+			return priceOffset{}, fmt.Errorf("preset %s: %s is required", p.Name, field)
+		}
+		return priceOffset{}, nil
+	}
+	o, err := parseOffset(str)
+	if err != nil {
+		return o, fmt.Errorf("preset %s: invalid %s '%s': %v", p.Name, field, str, err)
+	}
+	if required && o.zero() {
+		return o, fmt.Errorf("preset %s: %s must be greater than zero", p.Name, field)
+	}
+	return o, nil
+}
+
+// check validates a preset and parses its offsets
+func (p *Preset) check() error {
+	var err error
+
+	if p.Name == "" || strings.ContainsAny(p.Name, " \t") {
+		return fmt.Errorf("preset '%s': Name must be a single word", p.Name)
+	}
+
+	switch p.TIF = strings.ToUpper(p.TIF); p.TIF {
+	case "", "DAY", "GTC", "IOC":
+	default:
+		return fmt.Errorf("preset %s: TIF must be DAY, GTC or IOC", p.Name)
+	}
+
+	switch p.Type = strings.ToLower(p.Type); p.Type {
+	case "", "bracket":
+		p.Type = "bracket"
+		if p.target, err = p.parseOffset("Target", p.Target, true); err != nil {
+			return err
+		}
+		if p.stop, err = p.parseOffset("Stop", p.Stop, true); err != nil {
+			return err
+		}
+		if p.stopLimit, err = p.parseOffset("StopLimit", p.StopLimit, false); err != nil {
+			return err
+		}
+
+		switch p.TargetType = strings.ToUpper(p.TargetType); p.TargetType {
+		case "":
+			p.TargetType = "LMT"
+		case "LMT", "MIT":
+		default:
+			return fmt.Errorf("preset %s: TargetType must be LMT or MIT", p.Name)
+		}
+
+		switch p.StopType = strings.ToUpper(p.StopType); p.StopType {
+		case "":
+			p.StopType = "STP"
+		case "STP":
+		case "STP LMT":
+			if p.StopLimit == "" {
+				return fmt.Errorf("preset %s: a STP LMT stop needs StopLimit", p.Name)
+			}
+		default:
+			return fmt.Errorf("preset %s: StopType must be STP or STP LMT", p.Name)
+		}
+
+	case "trail":
+		if p.trail, err = p.parseOffset("Trail", p.Trail, true); err != nil {
+			return err
+		}
+
+		switch p.Action = strings.ToUpper(p.Action); p.Action {
+		case "":
+			p.Action = "SELL"
+		case "SELL", "BUY":
+		default:
+			return fmt.Errorf("preset %s: Action must be SELL or BUY", p.Name)
+		}
+
+	default:
+		return fmt.Errorf("preset %s: Type must be bracket or trail", p.Name)
+	}
+	return nil
+}
+
+// describe builds the help text of a preset that has none
+func (p *Preset) describe() string {
+	if p.Help != "" {
+		return p.Help
+	}
+
+	var parts []string
+	if p.Type == "trail" {
+		parts = append(parts, fmt.Sprintf("%s trailing by %s", strings.ToLower(p.Action), p.trail))
+	} else {
+		target := fmt.Sprintf("sell = buy + %s", p.target)
+		if p.TargetType != "LMT" {
+			target += " " + p.TargetType
+		}
+		stop := fmt.Sprintf("stp = buy - %s", p.stop)
+		if p.StopType == "STP LMT" {
+			stop += fmt.Sprintf(" lmt - %s", p.stopLimit)
+		}
+		parts = append(parts, fmt.Sprintf("bracket with {%s, %s}", target, stop))
+	}
+	if p.TIF != "" {
+		parts = append(parts, p.TIF)
+	}
+	if p.OutsideRTH != nil {
+		if *p.OutsideRTH {
+			parts = append(parts, "outside rth")
+		} else {
+			parts = append(parts, "rth only")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// bracket works out the bracket of a preset bought at buyprice
+func (p *Preset) bracket(symbol string, buyprice float64, atr float64) bracketOrder {
+	b := bracketOrder{
+		Direction:  dirLong,
+		Entry:      buyprice,
+		TargetType: p.TargetType,
+		StopType:   p.StopType,
+		TIF:        p.TIF,
+		OutsideRTH: p.OutsideRTH,
+	}
+	b.Target, b.Stop = bracketPrices(symbol, dirLong, buyprice, p.target, p.stop, atr)
+	if p.StopType == "STP LMT" {
+		b.StopLimit = roundTick(symbol, b.Stop-p.stopLimit.dollars(b.Stop, atr))
+	}
+	return b
+}
+
+// presetCommand turns a preset checked by LoadConfigFromFile into a command
+func presetCommand(p Preset) *command {
+	if p.Type == "trail" {
+		return &command{
+			name:  p.Name,
+			args:  []cmdArg{symbolArg, quantityArg},
+			help:  p.describe(),
+			order: true,
+			apply: func(ac *IBManager, a cmdArgs) error {
+				return doTrail(ac, a.symbol(0), a.quantity(1), p.Action, p.trail, p.TIF, p.OutsideRTH)
+			},
+		}
+	}
+
+	return &command{
+		name: p.Name,
+		args: []cmdArg{symbolArg, quantityArg, priceArg("buyprice")},
+		help: p.describe(),
+		check: func(a cmdArgs) error {
+			if needsATR(p.target, p.stop, p.stopLimit) {
+				return nil
+			}
+			b := p.bracket(a.symbol(0), a.price(2), 0)
+			return b.check()
+		},
+		order: true,
+		apply: func(ac *IBManager, a cmdArgs) error {
+			atr, err := ac.atrFor(a.symbol(0), p.target, p.stop, p.stopLimit)
+			if err != nil {
+				return err
+			}
+			b := p.bracket(a.symbol(0), a.price(2), atr)
+			if err := b.check(); err != nil {
+				return err
+			}
+			return placeBracket(ac, a.symbol(0), a.quantity(1), b)
+		},
+	}
+}
+
+// addPresets adds a command for each preset, refusing names already taken
+func (r *registry) addPresets(presets []Preset) error {
+	for _, p := range presets {
+		if r.find(p.Name) != nil {
+			return fmt.Errorf("preset %s has the name of a command", p.Name)
+		}
+		r.add(presetCommand(p))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestPresetCheck(t *testing.T) {
+	tests := []struct {
+		preset Preset
+		ok     bool
+	}{
+		{Preset{Name: "brk1", Target: "0.20", Stop: "0.05"}, true},
+		{Preset{Name: "brk1", Target: "1%", Stop: "1atr", TargetType: "mit", TIF: "gtc"}, true},
+		{Preset{Name: "brk1", Target: "0.20", Stop: "0.05", StopType: "stp lmt", StopLimit: "0.02"}, true},
+		{Preset{Name: "trl1", Type: "trail", Trail: "0.5%"}, true},
+		{Preset{Name: "trl1", Type: "trail", Trail: "2atr", Action: "buy"}, true},
+		{Preset{Name: "", Target: "0.20", Stop: "0.05"}, false},
+		{Preset{Name: "brk 1", Target: "0.20", Stop: "0.05"}, false},
+		{Preset{Name: "brk1", Stop: "0.05"}, false},
+		{Preset{Name: "brk1", Target: "0", Stop: "0.05"}, false},
+		{Preset{Name: "brk1", Target: "abc", Stop: "0.05"}, false},
+		{Preset{Name: "brk1", Target: "0.20", Stop: "0.05", TIF: "GTD"}, false},
+		{Preset{Name: "brk1", Target: "0.20", Stop: "0.05", TargetType: "MKT"}, false},
+		{Preset{Name: "brk1", Target: "0.20", Stop: "0.05", StopType: "STP LMT"}, false},
+		{Preset{Name: "brk1", Target: "0.20", Stop: "0.05", StopType: "TRAIL"}, false},
+		{Preset{Name: "trl1", Type: "trail"}, false},
+		{Preset{Name: "trl1", Type: "trail", Trail: "0.5", Action: "SHORT"}, false},
+		{Preset{Name: "x", Type: "oco"}, false},
+	}
+
+	for _, tt := range tests {
+		p := tt.preset
+		err := p.check()
+		if (err == nil) != tt.ok {
+			t.Errorf("%+v: error %v, want ok %v", tt.preset, err, tt.ok)
+		}
+	}
+}
+
+func TestPresetCheckDefaults(t *testing.T) {
+	p := Preset{Name: "brk1", Target: "1.5%", Stop: "0.05", TargetType: "mit"}
+	if err := p.check(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != "bracket" || p.TargetType != "MIT" || p.StopType != "STP" {
+		t.Errorf("checked preset is %s %s %s", p.Type, p.TargetType, p.StopType)
+	}
+	if p.target != (priceOffset{value: 1.5, unit: unitPercent}) || p.stop != (priceOffset{value: 0.05, unit: unitDollars}) {
+		t.Errorf("offsets %v %v", p.target, p.stop)
+	}
+
+	p = Preset{Name: "trl1", Type: "Trail", Trail: "0.25"}
+	if err := p.check(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != "trail" || p.Action != "SELL" || p.trail != (priceOffset{value: 0.25, unit: unitDollars}) {
+		t.Errorf("checked trail preset is %s %s %v", p.Type, p.Action, p.trail)
+	}
+}
+
+// TestLoadConfigChecksPresets loads the default presets along with the
+// config's, all checked, and refuses a config with a bad preset
+func TestLoadConfigChecksPresets(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, config string) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+
+	config, err := LoadConfigFromFile(write("good.js", `{"Presets": [{"Name": "brkp2", "Target": "0.30", "Stop": "0.10"}, {"Name": "trl1", "Type": "trail", "Trail": "1%"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	presets := config.presets()
+	if len(presets) != 3 {
+		t.Fatalf("%d presets, want 3", len(presets))
+	}
+	for _, p := range presets {
+		if p.Type == "" {
+			t.Errorf("preset %s was not checked", p.Name)
+		}
+	}
+	if presets[1].Name != "brkp2" || presets[1].target.value != 0.30 {
+		t.Errorf("brkp2 is %+v, want the config's", presets[1])
+	}
+
+	if _, err := LoadConfigFromFile(write("bad.js", `{"Presets": [{"Name": "brk1", "Target": "0.30"}]}`)); err == nil {
+		t.Errorf("config with a preset without a stop loaded")
+	}
+}
+
+// TestPresetStopLimit refuses a preset bracket whose stop limit falls to zero or below
+func TestPresetStopLimit(t *testing.T) {
+	p := Preset{Name: "brk1", Target: "1", Stop: "1", StopType: "STP LMT", StopLimit: "5"}
+	if err := p.check(); err != nil {
+		t.Fatal(err)
+	}
+	c := presetCommand(p)
+	if _, err := c.parse([]string{"AAPL", "100", "150"}); err != nil {
+		t.Errorf("bought at 150: %v", err)
+	}
+	if _, err := c.parse([]string{"AAPL", "100", "5"}); err == nil {
+		t.Errorf("bought at 5 the stop limit is -1")
+	}
+}
@@ -0,0 +1,229 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fiorix/go-readline"
+	"github.com/gofinance/ib"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderPrice is the price an order is expected to fill at, or 0 if unknown
+func orderPrice(o *ib.Order) float64 {
+	switch {
+	case o.LimitPrice > 0:
+		return o.LimitPrice
+	case o.TrailStopPrice > 0:
+		return o.TrailStopPrice
+	case o.OrderType == "STP":
+		return o.AuxPrice
+	}
+	return 0
+}
+
+// printPreview shows every leg of an order and the notional of its entry legs.
+// It goes to stderr with the question that follows, keeping stdout for results.
+func printPreview(mgr *IBManager, requests []*ib.PlaceOrder) {
+	fmt.Fprintf(os.Stderr, "%s: LIVE order preview\n", mgr.label)
+	fmt.Fprintf(os.Stderr, "  %6s %-4s %-8s %-11s %8s %10s %10s %-3s %-5s\n", "ID", "Act", "Symbol", "Type", "Quantity", "Limit", "Aux", "TIF", "ORTH")
+
+	notional := 0.0
+	known := true
+	for _, r := range requests {
+		o := &r.Order
+		fmt.Fprintf(os.Stderr, "  %6d %-4s %-8s %-11s %8d %10.2f %10.2f %-3s %-5v\n", r.ID(), o.Action, r.Contract.Symbol, o.OrderType, o.TotalQty, o.LimitPrice, o.AuxPrice, o.TIF, o.OutsideRTH)
+
+		// children of a bracket close the position the parent opens
+		if o.ParentID != 0 {
+			continue
+		}
+		price := orderPrice(o)
+		if price == 0 {
+			known = false
+		}
+		notional += price * multiplier(r.Contract) * float64(o.TotalQty)
+	}
+
+	if known {
+		fmt.Fprintf(os.Stderr, "  estimated notional: %.2f\n", notional)
+	} else {
+		fmt.Fprintf(os.Stderr, "  estimated notional: unknown (market or trailing entry)\n")
+	}
+}
+
+func confirm(question string) bool {
+	prompt := question + " (y/N)? "
+	answer := readline.Readline(&prompt)
+	if answer == nil {
+		fmt.Println()
+		return false
+	}
+	return strings.ToLower(strings.TrimSpace(*answer)) == "y"
+}
+
+// whatIfTimeout is how long a what-if waits for TWS to evaluate it
+const whatIfTimeout = 30 * time.Second
+
+// errWhatIf is returned by placeOrders when the orders were only evaluated
+var errWhatIf = errors.New("what-if order not transmitted")
+
+// sendWhatIf asks TWS to evaluate the entry legs of an order without transmitting them.
+// Children of a bracket are left out since they would be evaluated as new positions.
+func (m *IBManager) sendWhatIf(requests []*ib.PlaceOrder) {
+	for _, r := range requests {
+		if r.Order.ParentID != 0 {
+			continue
+		}
+		request := *r
+		request.Order.WhatIf = true
+		request.Order.Transmit = true
+
+		m.mu.Lock()
+		m.whatifs[request.ID()] = &request
+		m.mu.Unlock()
+
+		if err := m.send(&request); err != nil {
+			m.forgetWhatIf(&request)
+			log.Printf("%s: %v", m.label, err)
+			continue
+		}
+		time.AfterFunc(whatIfTimeout, func() {
+			if m.forgetWhatIf(&request) {
+				log.Printf("%s: WHATIF %v not answered after %v", m.label, request.ID(), whatIfTimeout)
+			}
+		})
+		log.Printf("%s: WHATIF - %s %v %s %s", m.label, request.Order.Action, request.Order.TotalQty, request.Contract.Symbol, request.Order.OrderType)
+	}
+}
+
+// takeWhatIf returns the what-if request an order id belongs to, if any
+func (m *IBManager) takeWhatIf(id int64) (*ib.PlaceOrder, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	request, ok := m.whatifs[id]
+	delete(m.whatifs, id)
+	return request, ok
+}
+
+// forgetWhatIf drops a what-if request unless a newer one took its id,
+// telling whether it was still waiting
+func (m *IBManager) forgetWhatIf(request *ib.PlaceOrder) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.whatifs[request.ID()] != request {
+		return false
+	}
+	delete(m.whatifs, request.ID())
+	return true
+}
+
+// marginValue formats a margin figure from OrderState, hiding unset values
+func marginValue(str string) string {
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return str
+	}
+	if FloatAdjustValue(val) == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", val)
+}
+
+// whatIfResult is the JSON form of a what-if order's margin and commission impact
+type whatIfResult struct {
+	Action         string
+	Quantity       int64
+	Symbol         string
+	OrderType      string
+	LimitPrice     float64
+	AuxPrice       float64
+	InitMargin     string
+	MaintMargin    string
+	EquityWithLoan string
+	Commission     float64
+	MinCommission  float64
+	MaxCommission  float64
+	Warning        string `json:",omitempty"`
+}
+
+func printWhatIf(mgr *IBManager, request *ib.PlaceOrder, state ib.OrderState) {
+	o := &request.Order
+	if mgr.out.Format() == formatJSON {
+		mgr.out.json("whatif", mgr.label, whatIfResult{
+			Action:         o.Action,
+			Quantity:       o.TotalQty,
+			Symbol:         request.Contract.Symbol,
+			OrderType:      o.OrderType,
+			LimitPrice:     o.LimitPrice,
+			AuxPrice:       o.AuxPrice,
+			InitMargin:     marginValue(state.InitMargin),
+			MaintMargin:    marginValue(state.MaintenanceMargin),
+			EquityWithLoan: marginValue(state.EquityWithLoan),
+			Commission:     FloatAdjustValue(state.Commission),
+			MinCommission:  FloatAdjustValue(state.MinCommission),
+			MaxCommission:  FloatAdjustValue(state.MaxCommission),
+			Warning:        state.WarningText,
+		})
+		return
+	}
+
+	fmt.Printf("%s: WHATIF %s %v %s %s l:%.2f a:%.2f\n", mgr.label, o.Action, o.TotalQty, request.Contract.Symbol, o.OrderType, o.LimitPrice, o.AuxPrice)
+	fmt.Printf("  %-18s %14s\n", "Init Margin", marginValue(state.InitMargin))
+	fmt.Printf("  %-18s %14s\n", "Maint Margin", marginValue(state.MaintenanceMargin))
+	fmt.Printf("  %-18s %14s\n", "Equity With Loan", marginValue(state.EquityWithLoan))
+	fmt.Printf("  %-18s %14.2f\n", "Commission", FloatAdjustValue(state.Commission))
+	fmt.Printf("  %-18s %14.2f\n", "Min Commission", FloatAdjustValue(state.MinCommission))
+	fmt.Printf("  %-18s %14.2f\n", "Max Commission", FloatAdjustValue(state.MaxCommission))
+	if state.WarningText != "" {
+		fmt.Printf("  %-18s %s\n", "Warning", state.WarningText)
+	}
+}
+
+// placeOrders sends the orders, asking first when the account trades real money
+func (m *IBManager) placeOrders(requests ...*ib.PlaceOrder) error {
+	if m.whatif {
+		m.sendWhatIf(requests)
+		return errWhatIf
+	}
+
+	if !m.paper && !m.skipConfirm {
+		printPreview(m, requests)
+		if !m.confirm("Send to " + m.label) {
+			return fmt.Errorf("order not confirmed")
+		}
+	}
+
+	for _, r := range requests {
+		if m.trackAcks {
+			m.expectAck(r.ID())
+		}
+		if err := m.send(r); err != nil {
+			return err
+		}
+		m.orders.placed(r)
+	}
+	return nil
+}
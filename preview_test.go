@@ -0,0 +1,49 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"github.com/gofinance/ib"
+	"testing"
+)
+
+func TestForgetWhatIf(t *testing.T) {
+	m := &IBManager{whatifs: make(map[int64]*ib.PlaceOrder)}
+
+	first := &ib.PlaceOrder{}
+	first.SetID(5)
+	second := &ib.PlaceOrder{}
+	second.SetID(5)
+
+	// a second whatif modify on the same order replaces the first
+	m.whatifs[5] = first
+	m.whatifs[5] = second
+	if m.forgetWhatIf(first) {
+		t.Errorf("forgot the newer what-if through the older one")
+	}
+	if _, ok := m.whatifs[5]; !ok {
+		t.Fatalf("newer what-if dropped")
+	}
+
+	if !m.forgetWhatIf(second) {
+		t.Errorf("what-if was not waiting")
+	}
+	if _, ok := m.takeWhatIf(5); ok {
+		t.Errorf("what-if still waiting after it was forgotten")
+	}
+}
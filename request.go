@@ -0,0 +1,282 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"github.com/gofinance/ib"
+	"sort"
+	"time"
+)
+
+// requestTimeout is how long a command waits for TWS to finish answering a request
+const requestTimeout = 10 * time.Second
+
+// replyFilter picks replies out of the engine's reply stream
+type replyFilter func(ib.Reply) bool
+
+// waiter collects the replies to one request until its end marker arrives
+type waiter struct {
+	match   replyFilter
+	end     replyFilter
+	replies []ib.Reply
+	err     error
+	done    chan struct{}
+
+	// claim keeps engineLoop from logging the matched replies
+	claim bool
+}
+
+// byID matches replies carrying a request or order id
+func byID(id int64) replyFilter {
+	return func(r ib.Reply) bool {
+		mr, ok := r.(ib.MatchedReply)
+		return ok && mr.ID() == id
+	}
+}
+
+// orderReply matches the order status and errors for an order id
+func orderReply(id int64) replyFilter {
+	return func(r ib.Reply) bool {
+		switch r := r.(type) {
+		case *ib.OrderStatus:
+			return r.ID() == id
+		case *ib.ErrorMessage:
+			return r.ID() == id
+		}
+		return false
+	}
+}
+
+func isOrderStatus(r ib.Reply) bool {
+	_, ok := r.(*ib.OrderStatus)
+	return ok
+}
+
+// expect registers interest in the replies to a request about to be sent
+func (m *IBManager) expect(match replyFilter, end replyFilter, claim bool) *waiter {
+	w := &waiter{
+		match: match,
+		end:   end,
+		done:  make(chan struct{}),
+		claim: claim,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.waiters = append(m.waiters, w)
+	return w
+}
+
+func (m *IBManager) forget(w *waiter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, x := range m.waiters {
+		if x == w {
+			m.waiters = append(m.waiters[:i], m.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch hands a reply to the waiters it belongs to.  It reports whether
+// a waiter claimed it, in which case the reply is not logged by engineLoop.
+func (m *IBManager) dispatch(r ib.Reply) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	claimed := false
+	waiters := m.waiters[:0]
+	for _, w := range m.waiters {
+		if !w.match(r) {
+			waiters = append(waiters, w)
+			continue
+		}
+		if w.claim {
+			claimed = true
+		}
+
+		if e, ok := r.(*ib.ErrorMessage); ok {
+			if isOrderError(e.Code) {
+				w.err = fmt.Errorf("%s: %v (code %v)", m.label, e.Message, e.Code)
+				close(w.done)
+				continue
+			}
+		} else if w.end(r) {
+			w.replies = append(w.replies, r)
+			close(w.done)
+			continue
+		} else {
+			w.replies = append(w.replies, r)
+		}
+		waiters = append(waiters, w)
+	}
+	m.waiters = waiters
+	return claimed
+}
+
+// failWaiters ends every pending request with err
+func (m *IBManager) failWaiters(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, w := range m.waiters {
+		w.err = err
+		close(w.done)
+	}
+	m.waiters = nil
+}
+
+// wait returns the replies once the end marker arrived, or fails on error or timeout
+func (m *IBManager) wait(w *waiter, timeout time.Duration) ([]ib.Reply, error) {
+	select {
+	case <-w.done:
+		return w.replies, w.err
+	default:
+	}
+
+	select {
+	case <-w.done:
+		return w.replies, w.err
+	case <-time.After(timeout):
+		m.forget(w)
+		return nil, fmt.Errorf("%s: timed out waiting for TWS", m.label)
+	}
+}
+
+// request sends req and waits for every reply it matches, up to and including end
+func (m *IBManager) request(req ib.Request, match replyFilter, end replyFilter, timeout time.Duration) ([]ib.Reply, error) {
+	w := m.expect(match, end, true)
+	if err := m.send(req); err != nil {
+		m.forget(w)
+		return nil, err
+	}
+	return m.wait(w, timeout)
+}
+
+// AccountSummary requests the given account summary tags
+func (m *IBManager) AccountSummary(tags string) ([]*ib.AccountSummary, error) {
+	id := m.nextRequestID()
+	req := &ib.RequestAccountSummary{}
+	req.SetID(id)
+	req.Group = "All"
+	req.Tags = tags
+
+	replies, err := m.request(req, byID(id), func(r ib.Reply) bool {
+		_, ok := r.(*ib.AccountSummaryEnd)
+		return ok
+	}, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary []*ib.AccountSummary
+	for _, r := range replies {
+		if r, ok := r.(*ib.AccountSummary); ok {
+			summary = append(summary, r)
+		}
+	}
+	return summary, nil
+}
+
+// Positions requests every position held in the account
+func (m *IBManager) Positions() ([]*ib.Position, error) {
+	isPosition := func(r ib.Reply) bool {
+		switch r.(type) {
+		case *ib.Position, *ib.PositionEnd:
+			return true
+		}
+		return false
+	}
+	replies, err := m.request(&ib.RequestPositions{}, isPosition, func(r ib.Reply) bool {
+		_, ok := r.(*ib.PositionEnd)
+		return ok
+	}, requestTimeout)
+
+	// positions keep streaming until cancelled
+	m.send(&ib.CancelPositions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var positions []*ib.Position
+	for _, r := range replies {
+		if r, ok := r.(*ib.Position); ok {
+			positions = append(positions, r)
+		}
+	}
+	return positions, nil
+}
+
+// OpenOrders requests the open orders placed by this client
+func (m *IBManager) OpenOrders() ([]*ib.OpenOrder, error) {
+	isOpenOrder := func(r ib.Reply) bool {
+		switch r.(type) {
+		case *ib.OpenOrder, *ib.OpenOrderEnd:
+			return true
+		}
+		return false
+	}
+	replies, err := m.request(&ib.RequestOpenOrders{}, isOpenOrder, func(r ib.Reply) bool {
+		_, ok := r.(*ib.OpenOrderEnd)
+		return ok
+	}, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*ib.OpenOrder
+	for _, r := range replies {
+		if r, ok := r.(*ib.OpenOrder); ok {
+			orders = append(orders, r)
+		}
+	}
+	return orders, nil
+}
+
+// Executions requests today's executions, paired with their commission reports
+// and sorted by time
+func (m *IBManager) Executions() (TimeSlice, error) {
+	m.mu.Lock()
+	m.elog = make(map[string]*ExecutionInfo)
+	m.mu.Unlock()
+
+	id := m.nextRequestID()
+	req := &ib.RequestExecutions{}
+	req.SetID(id)
+
+	_, err := m.request(req, byID(id), func(r ib.Reply) bool {
+		_, ok := r.(*ib.ExecutionDataEnd)
+		return ok
+	}, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var keys TimeSlice
+	for _, k := range m.elog {
+		info := *k
+		keys = append(keys, &info)
+	}
+	sort.Sort(keys)
+	return keys, nil
+}
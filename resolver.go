@@ -0,0 +1,206 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gofinance/ib"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// contractTimeout is how long to wait for TWS to answer RequestContractData
+	contractTimeout = 10 * time.Second
+	// contractMaxAge is how long a cached contract is trusted
+	contractMaxAge = 7 * 24 * time.Hour
+)
+
+// ContractInfo is the part of ib.ContractDetails kept in the contract cache
+type ContractInfo struct {
+	Contract       ib.Contract
+	LongName       string
+	MinTick        float64
+	ValidExchanges string
+	TradingHours   string
+	LiquidHours    string
+	TimezoneID     string
+	Updated        time.Time
+}
+
+func newContractInfo(d *ib.ContractDetails) ContractInfo {
+	return ContractInfo{
+		Contract:       d.Summary,
+		LongName:       d.LongName,
+		MinTick:        d.MinTick,
+		ValidExchanges: d.ValidExchanges,
+		TradingHours:   d.TradingHours,
+		LiquidHours:    d.LiquidHours,
+		TimezoneID:     d.TimezoneID,
+		Updated:        time.Now(),
+	}
+}
+
+// contractCache holds resolved contracts by spec and is saved to disk on every change
+type contractCache struct {
+	mu        sync.Mutex
+	filename  string
+	contracts map[string]ContractInfo
+}
+
+func loadContractCache(filename string) *contractCache {
+	c := &contractCache{
+		filename:  filename,
+		contracts: make(map[string]ContractInfo),
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return c
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&c.contracts); err != nil {
+		log.Printf("ERROR reading contract cache %s: %v", filename, err)
+	}
+	return c
+}
+
+func (c *contractCache) get(spec string) (ContractInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, ok := c.contracts[spec]
+	if ok && time.Since(info.Updated) > contractMaxAge {
+		return info, false
+	}
+	return info, ok
+}
+
+func (c *contractCache) put(spec string, info ContractInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.contracts[spec] = info
+
+	file, err := os.Create(c.filename)
+	if err != nil {
+		log.Printf("ERROR writing contract cache %s: %v", c.filename, err)
+		return
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(c.contracts); err != nil {
+		log.Printf("ERROR writing contract cache %s: %v", c.filename, err)
+	}
+}
+
+// requestContractDetails asks TWS for every contract matching a partial contract
+func (m *IBManager) requestContractDetails(contract ib.Contract) ([]ib.ContractDetails, error) {
+	id := m.nextRequestID()
+	req := &ib.RequestContractData{Contract: contract}
+	req.SetID(id)
+
+	replies, err := m.request(req, byID(id), func(r ib.Reply) bool {
+		_, ok := r.(*ib.ContractDataEnd)
+		return ok
+	}, contractTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var details []ib.ContractDetails
+	for _, r := range replies {
+		if r, ok := r.(*ib.ContractData); ok {
+			details = append(details, r.Contract)
+		}
+	}
+	return details, nil
+}
+
+// lookupContract finds the single contract known to TWS for a contract spec,
+// refusing specs that match nothing or more than one contract
+func (m *IBManager) lookupContract(spec string) (ib.Contract, ContractInfo, error) {
+	contract, err := NewContract(spec)
+	if err != nil {
+		return contract, ContractInfo{}, err
+	}
+
+	info, ok := m.contracts.get(spec)
+	if ok {
+		return contract, info, nil
+	}
+
+	details, err := m.requestContractDetails(contract)
+	if err != nil {
+		return contract, info, fmt.Errorf("%s: %v", spec, err)
+	}
+
+	switch len(details) {
+	case 0:
+		return contract, info, fmt.Errorf("%s: unknown contract", spec)
+	case 1:
+	default:
+		var matches []string
+		for _, d := range details {
+			s := d.Summary
+			matches = append(matches, fmt.Sprintf("%s %s %s %s (%s)", s.Symbol, s.SecurityType, s.PrimaryExchange, s.Currency, d.LongName))
+		}
+		return contract, info, fmt.Errorf("%s is ambiguous: %s", spec, strings.Join(matches, ", "))
+	}
+
+	info = newContractInfo(&details[0])
+	m.contracts.put(spec, info)
+	return contract, info, nil
+}
+
+// resolveContract turns a contract spec into a single contract known to TWS
+func (m *IBManager) resolveContract(spec string) (ib.Contract, error) {
+	contract, info, err := m.lookupContract(spec)
+	if err != nil {
+		return contract, err
+	}
+
+	contract.ContractID = info.Contract.ContractID
+	contract.LocalSymbol = info.Contract.LocalSymbol
+	if info.Contract.Multiplier != "" {
+		contract.Multiplier = info.Contract.Multiplier
+	}
+	return contract, nil
+}
+
+// printContract shows what TWS knows about a contract
+func printContract(out *printer, label string, spec string, info ContractInfo) {
+	if out.Format() == formatJSON {
+		out.json("contract", label, info)
+		return
+	}
+
+	c := info.Contract
+	fmt.Printf("%s: %s\n", spec, info.LongName)
+	fmt.Printf("  %-16s %v\n", "ConId", c.ContractID)
+	fmt.Printf("  %-16s %s %s %s %s\n", "Contract", c.Symbol, c.SecurityType, c.LocalSymbol, c.Currency)
+	fmt.Printf("  %-16s %v\n", "Min Tick", info.MinTick)
+	fmt.Printf("  %-16s %s\n", "Exchanges", info.ValidExchanges)
+	fmt.Printf("  %-16s %s %s\n", "Trading Hours", info.TimezoneID, info.TradingHours)
+	fmt.Printf("  %-16s %s\n", "Liquid Hours", info.LiquidHours)
+}
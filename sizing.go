@@ -0,0 +1,127 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// riskAmount is how much an order may lose at its stop, in dollars or as a
+// percentage of the account's net liquidation value
+type riskAmount struct {
+	value   float64
+	percent bool
+}
+
+func (r riskAmount) String() string {
+	if r.percent {
+		return fmt.Sprintf("%g%%", r.value)
+	}
+	return fmt.Sprintf("$%g", r.value)
+}
+
+// parseRisk reads 500, $500 or 1.5%
+func parseRisk(str string) (riskAmount, error) {
+	var r riskAmount
+	if strings.HasSuffix(str, "%") {
+		r.percent = true
+		str = strings.TrimSuffix(str, "%")
+	} else {
+		str = strings.TrimPrefix(str, "$")
+	}
+
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil || math.IsNaN(val) || math.IsInf(val, 0) || val <= 0 {
+		return r, fmt.Errorf("must be a dollar amount or a percentage like 1%%")
+	}
+	if r.percent && val > 100 {
+		return r, fmt.Errorf("must not be more than 100%%")
+	}
+	r.value = val
+	return r, nil
+}
+
+// accountFunds fetches NetLiquidation and AvailableFunds for the account
+func (m *IBManager) accountFunds() (netliq float64, available float64, err error) {
+	summary, err := m.AccountSummary("NetLiquidation,AvailableFunds")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	accounts := make(map[string]bool)
+	found := 0
+	for _, r := range summary {
+		val, perr := strconv.ParseFloat(r.Value, 64)
+		if perr != nil {
+			continue
+		}
+		accounts[r.Key.AccountCode] = true
+		switch r.Key.Key {
+		case "NetLiquidation":
+			netliq = val
+			found++
+		case "AvailableFunds":
+			available = val
+			found++
+		}
+	}
+	if len(accounts) > 1 {
+		return 0, 0, fmt.Errorf("%s reports %d accounts, can't size by risk", m.label, len(accounts))
+	}
+	if found < 2 {
+		return 0, 0, fmt.Errorf("%s did not report NetLiquidation and AvailableFunds", m.label)
+	}
+	return netliq, available, nil
+}
+
+// riskQuantity sizes an order so that a fill at buyprice stopped out at
+// stopprice loses at most risk, without needing more than the available funds
+func (m *IBManager) riskQuantity(symbol string, risk riskAmount, buyprice float64, stopprice float64) (uint64, error) {
+	contract, err := m.resolveContract(symbol)
+	if err != nil {
+		return 0, err
+	}
+	mult := multiplier(contract)
+
+	netliq, available, err := m.accountFunds()
+	if err != nil {
+		return 0, err
+	}
+
+	dollars := risk.value
+	if risk.percent {
+		dollars = netliq * risk.value / 100
+	}
+
+	perShare := math.Abs(buyprice-stopprice) * mult
+	quantity := math.Floor(dollars/perShare + 1e-9)
+	if afford := math.Floor(available / (buyprice * mult)); afford < quantity {
+		log.Printf("%s: RISK - AvailableFunds %.2f only cover %v of %v", m.label, available, afford, quantity)
+		quantity = afford
+	}
+	if quantity < 1 {
+		return 0, fmt.Errorf("risk %s (%.2f) is less than one share at %.2f risk each", risk, dollars, perShare)
+	}
+
+	log.Printf("%s: RISK - %s of NetLiquidation %.2f is %.2f, %v at %.2f risk each", m.label, risk, netliq, dollars, quantity, perShare)
+	return uint64(quantity), nil
+}
@@ -0,0 +1,325 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+type matchMethod int
+
+const (
+	matchFIFO matchMethod = iota
+	matchLIFO
+	matchAverage
+)
+
+func parseMatchMethod(str string) (matchMethod, bool) {
+	switch str {
+	case "fifo":
+		return matchFIFO, true
+	case "lifo":
+		return matchLIFO, true
+	case "average", "avg":
+		return matchAverage, true
+	}
+	return matchFIFO, false
+}
+
+// Trade is a closing fill matched against the fills that opened the position
+type Trade struct {
+	Label      string
+	Symbol     string
+	Direction  string
+	Quantity   int64
+	EntryTime  time.Time
+	ExitTime   time.Time
+	EntryPrice float64
+	ExitPrice  float64
+	GrossPNL   float64
+	Commission float64
+	NetPNL     float64
+	Holding    time.Duration
+	// MAE and MFE are the worst and best open PnL while held, when bars cover the trade
+	HasBars bool
+	MAE     float64
+	MFE     float64
+}
+
+// lot is an open part of a position, negative quantities are short
+type lot struct {
+	quantity   int64
+	price      float64
+	commission float64 // per share
+	time       time.Time
+}
+
+func sign(val int64) int64 {
+	switch {
+	case val > 0:
+		return 1
+	case val < 0:
+		return -1
+	}
+	return 0
+}
+
+// matchTrades pairs closing fills with opening fills per account and symbol.
+// The entries must be sorted by time.
+func matchTrades(entries []HistoryEntry, method matchMethod, bars *barStore) []Trade {
+	open := make(map[string][]lot)
+	var trades []Trade
+
+	for _, e := range entries {
+		x := &e.Execution.ExecutionData
+		symbol := positionKey(x.Contract)
+		key := e.Label + "/" + symbol
+
+		mult := multiplier(x.Contract)
+
+		shares := x.Exec.Shares
+		if x.Exec.Side == "SLD" {
+			shares = -shares
+		}
+		if shares == 0 {
+			continue
+		}
+		perShare := e.Execution.Commission.Commission / float64(x.Exec.Shares)
+
+		lots := open[key]
+		remaining := shares
+		var closed int64
+		var entryValue, entryCommission float64
+		var entryTime time.Time
+		direction := "LONG"
+
+		for remaining != 0 && len(lots) > 0 && sign(lots[0].quantity) != sign(remaining) {
+			i := 0
+			if method == matchLIFO {
+				i = len(lots) - 1
+			}
+			l := &lots[i]
+			if l.quantity < 0 {
+				direction = "SHORT"
+			}
+
+			n := l.quantity
+			if n < 0 {
+				n = -n
+			}
+			if r := abs64(remaining); r < n {
+				n = r
+			}
+
+			entryValue += float64(n) * l.price
+			entryCommission += float64(n) * l.commission
+			if entryTime.IsZero() || l.time.Before(entryTime) {
+				entryTime = l.time
+			}
+			closed += n
+
+			l.quantity -= n * sign(l.quantity)
+			remaining -= n * sign(remaining)
+			if l.quantity == 0 {
+				lots = append(lots[:i], lots[i+1:]...)
+			}
+		}
+
+		if closed > 0 {
+			t := Trade{
+				Label:      e.Label,
+				Symbol:     symbol,
+				Direction:  direction,
+				Quantity:   closed,
+				EntryTime:  entryTime,
+				ExitTime:   x.Exec.Time,
+				EntryPrice: entryValue / float64(closed),
+				ExitPrice:  x.Exec.Price,
+				Commission: entryCommission + float64(closed)*perShare,
+				Holding:    x.Exec.Time.Sub(entryTime),
+			}
+			dir := 1.0
+			if direction == "SHORT" {
+				dir = -1.0
+			}
+			t.GrossPNL = dir * (t.ExitPrice - t.EntryPrice) * float64(closed) * mult
+			t.NetPNL = t.GrossPNL - t.Commission
+
+			if bars != nil {
+				if list := bars.between([]string{symbol, x.Contract.Symbol}, t.EntryTime, t.ExitTime); len(list) > 0 {
+					t.HasBars = true
+					t.MAE, t.MFE = 0, 0
+					for _, b := range list {
+						var worst, best float64
+						if dir > 0 {
+							worst, best = b.Low-t.EntryPrice, b.High-t.EntryPrice
+						} else {
+							worst, best = t.EntryPrice-b.High, t.EntryPrice-b.Low
+						}
+						worst *= float64(closed) * mult
+						best *= float64(closed) * mult
+						if worst < t.MAE {
+							t.MAE = worst
+						}
+						if best > t.MFE {
+							t.MFE = best
+						}
+					}
+				}
+			}
+			trades = append(trades, t)
+		}
+
+		if remaining != 0 {
+			if method == matchAverage && len(lots) > 0 {
+				l := &lots[0]
+				total := l.quantity + remaining
+				l.price = (l.price*float64(l.quantity) + x.Exec.Price*float64(remaining)) / float64(total)
+				l.commission = (l.commission*float64(abs64(l.quantity)) + perShare*float64(abs64(remaining))) / float64(abs64(total))
+				l.quantity = total
+			} else {
+				lots = append(lots, lot{
+					quantity:   remaining,
+					price:      x.Exec.Price,
+					commission: perShare,
+					time:       x.Exec.Time,
+				})
+			}
+		}
+		open[key] = lots
+	}
+	return trades
+}
+
+// parseTradesArgs splits [fifo|lifo|average] [symbol] [from] [to]
+func parseTradesArgs(strs []string) (method matchMethod, symbol string, from time.Time, to time.Time, err error) {
+	if len(strs) > 0 {
+		if m, ok := parseMatchMethod(strs[0]); ok {
+			method = m
+			strs = strs[1:]
+		}
+	}
+	symbol, from, to, err = parseHistoryArgs(strs)
+	return method, symbol, from, to, err
+}
+
+// tradeSummary totals the trades for one day or symbol
+type tradeSummary struct {
+	Group      string
+	Trades     int
+	Winners    int
+	Losers     int
+	GrossPNL   float64
+	Commission float64
+	NetPNL     float64
+	Holding    time.Duration
+}
+
+func (s *tradeSummary) add(t Trade) {
+	s.Trades++
+	if t.NetPNL > 0 {
+		s.Winners++
+	} else if t.NetPNL < 0 {
+		s.Losers++
+	}
+	s.GrossPNL += t.GrossPNL
+	s.Commission += t.Commission
+	s.NetPNL += t.NetPNL
+	s.Holding += t.Holding
+}
+
+// summarize totals the trades by the group each belongs to, sorted by group
+func summarize(trades []Trade, group func(t Trade) string) []*tradeSummary {
+	byGroup := make(map[string]*tradeSummary)
+	var list []*tradeSummary
+	for _, t := range trades {
+		g := group(t)
+		s, ok := byGroup[g]
+		if !ok {
+			s = &tradeSummary{Group: g}
+			byGroup[g] = s
+			list = append(list, s)
+		}
+		s.add(t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Group < list[j].Group })
+	return list
+}
+
+type tradeRecord struct {
+	Trade
+}
+
+func (r tradeRecord) kind() string { return "trade" }
+
+func (r tradeRecord) excursion() string {
+	if !r.HasBars {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f/%.2f", r.MAE, r.MFE)
+}
+
+func (r tradeRecord) text(label string) string {
+	return fmt.Sprintf("%s: %s %-7s %-5s %5d %8.2f -> %8.2f gross %9.2f comm %6.2f net %9.2f held %v mae/mfe %s",
+		label, r.ExitTime.Format("2006-01-02 15:04:05"), r.Symbol, r.Direction, r.Quantity, r.EntryPrice, r.ExitPrice,
+		r.GrossPNL, r.Commission, r.NetPNL, r.Holding, r.excursion())
+}
+
+func (r tradeRecord) header() []string {
+	return []string{"Exit", "Symbol", "Dir", "Qty", "Entry", "ExitPx", "Gross", "Comm", "Net", "Held", "MAE/MFE"}
+}
+
+func (r tradeRecord) cells() []string {
+	return []string{r.ExitTime.Format("2006-01-02 15:04:05"), r.Symbol, r.Direction, fmt.Sprint(r.Quantity),
+		money(r.EntryPrice), money(r.ExitPrice), money(r.GrossPNL), money(r.Commission), money(r.NetPNL),
+		r.Holding.String(), r.excursion()}
+}
+
+type tradeSummaryRecord struct {
+	*tradeSummary
+	By string
+}
+
+func (r tradeSummaryRecord) kind() string { return "trades_by_" + r.By }
+
+func (r tradeSummaryRecord) averageHolding() time.Duration {
+	if r.Trades == 0 {
+		return 0
+	}
+	return (r.Holding / time.Duration(r.Trades)).Round(time.Second)
+}
+
+func (r tradeSummaryRecord) text(label string) string {
+	return fmt.Sprintf("%s: %-10s %4d trades %4d won %4d lost gross %10.2f comm %8.2f net %10.2f avg held %v",
+		label, r.Group, r.Trades, r.Winners, r.Losers, r.GrossPNL, r.Commission, r.NetPNL, r.averageHolding())
+}
+
+func (r tradeSummaryRecord) header() []string {
+	by := "Day"
+	if r.By == "symbol" {
+		by = "Symbol"
+	}
+	return []string{by, "Trades", "Won", "Lost", "Gross", "Comm", "Net", "AvgHeld"}
+}
+
+func (r tradeSummaryRecord) cells() []string {
+	return []string{r.Group, fmt.Sprint(r.Trades), fmt.Sprint(r.Winners), fmt.Sprint(r.Losers),
+		money(r.GrossPNL), money(r.Commission), money(r.NetPNL), r.averageHolding().String()}
+}
@@ -0,0 +1,158 @@
+/* ibstockcli - A command line program to interact with the IB TWS API using the gofinance/ib library
+ *
+ * Copyright (C) 2015 Ellery D'Souza <edsouza99@gmail.com>
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ */
+package main
+
+import (
+	"github.com/gofinance/ib"
+	"math"
+	"testing"
+	"time"
+)
+
+var tradesStart = time.Date(2026, 3, 2, 14, 30, 0, 0, time.UTC)
+
+// fill makes a stored execution, minute minutes after tradesStart
+func fill(label string, contract ib.Contract, side string, shares int64, price float64, commission float64, minute int) HistoryEntry {
+	var e HistoryEntry
+	e.Label = label
+	e.Execution.ExecutionData.Contract = contract
+	e.Execution.ExecutionData.Exec.Side = side
+	e.Execution.ExecutionData.Exec.Shares = shares
+	e.Execution.ExecutionData.Exec.Price = price
+	e.Execution.ExecutionData.Exec.Time = tradesStart.Add(time.Duration(minute) * time.Minute)
+	e.Execution.Commission.Commission = commission
+	return e
+}
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestMatchTrades(t *testing.T) {
+	aapl := ib.Contract{Symbol: "AAPL", SecurityType: "STK", Currency: "USD"}
+	option := ib.Contract{Symbol: "AAPL", LocalSymbol: "AAPL  261218C00200000", SecurityType: "OPT", Multiplier: "100"}
+
+	scaleIn := []HistoryEntry{
+		fill("ib1", aapl, "BOT", 100, 10, 1, 0),
+		fill("ib1", aapl, "BOT", 100, 12, 1, 1),
+		fill("ib1", aapl, "SLD", 150, 13, 1.5, 2),
+	}
+
+	type want struct {
+		direction  string
+		quantity   int64
+		entryPrice float64
+		grossPNL   float64
+		commission float64
+	}
+	tests := []struct {
+		name    string
+		method  matchMethod
+		entries []HistoryEntry
+		want    []want
+	}{
+		// 100@10 + 50@12, commissions of 0.01 a share on both sides
+		{"fifo", matchFIFO, scaleIn, []want{{"LONG", 150, 1600.0 / 150, 350, 3}}},
+		// 100@12 + 50@10
+		{"lifo", matchLIFO, scaleIn, []want{{"LONG", 150, 1700.0 / 150, 250, 3}}},
+		// one lot at 11
+		{"average", matchAverage, scaleIn, []want{{"LONG", 150, 11, 300, 3}}},
+		{"short", matchFIFO, []HistoryEntry{
+			fill("ib1", aapl, "SLD", 10, 20, 1, 0),
+			fill("ib1", aapl, "BOT", 10, 18, 1, 5),
+		}, []want{{"SHORT", 10, 20, 20, 2}}},
+		// selling more than is held closes the long and opens a short
+		{"flip", matchFIFO, []HistoryEntry{
+			fill("ib1", aapl, "BOT", 100, 10, 1, 0),
+			fill("ib1", aapl, "SLD", 150, 11, 1.5, 1),
+			fill("ib1", aapl, "BOT", 50, 12, 0.5, 2),
+		}, []want{{"LONG", 100, 10, 100, 2}, {"SHORT", 50, 11, -50, 1}}},
+		{"multiplier", matchFIFO, []HistoryEntry{
+			fill("ib1", option, "BOT", 2, 2, 1.3, 0),
+			fill("ib1", option, "SLD", 2, 3.5, 1.3, 1),
+		}, []want{{"LONG", 2, 2, 300, 2.6}}},
+		// accounts never match each other's fills
+		{"accounts", matchFIFO, []HistoryEntry{
+			fill("ib1", aapl, "BOT", 10, 10, 0, 0),
+			fill("ib2", aapl, "SLD", 10, 11, 0, 1),
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		trades := matchTrades(tt.entries, tt.method, nil)
+		if len(trades) != len(tt.want) {
+			t.Errorf("%s: %d trades, want %d", tt.name, len(trades), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			tr := trades[i]
+			if tr.Direction != w.direction || tr.Quantity != w.quantity || !near(tr.EntryPrice, w.entryPrice) ||
+				!near(tr.GrossPNL, w.grossPNL) || !near(tr.Commission, w.commission) || !near(tr.NetPNL, w.grossPNL-w.commission) {
+				t.Errorf("%s: trade %d is %+v, want %+v", tt.name, i, tr, w)
+			}
+		}
+	}
+}
+
+func TestMatchTradesExcursion(t *testing.T) {
+	aapl := ib.Contract{Symbol: "AAPL", SecurityType: "STK", Currency: "USD"}
+	bars := newBarStore()
+	bars.bars["AAPL"] = []Bar{
+		{Time: tradesStart.Add(2 * time.Minute), Low: 9.5, High: 10.5},
+		{Time: tradesStart.Add(5 * time.Minute), Low: 9.8, High: 11.5},
+		// after the exit, left out
+		{Time: tradesStart.Add(20 * time.Minute), Low: 5, High: 20},
+	}
+
+	entries := []HistoryEntry{
+		fill("ib1", aapl, "BOT", 100, 10, 0, 0),
+		fill("ib1", aapl, "SLD", 100, 11, 0, 10),
+	}
+	trades := matchTrades(entries, matchFIFO, bars)
+	if len(trades) != 1 {
+		t.Fatalf("%d trades", len(trades))
+	}
+	tr := trades[0]
+	if !tr.HasBars || !near(tr.MAE, -50) || !near(tr.MFE, 150) {
+		t.Errorf("excursion %v %v/%v, want -50/150", tr.HasBars, tr.MAE, tr.MFE)
+	}
+	if tr.Holding != 10*time.Minute {
+		t.Errorf("held %v", tr.Holding)
+	}
+
+	// without bars covering the trade there is no excursion
+	trades = matchTrades(entries, matchFIFO, newBarStore())
+	if trades[0].HasBars {
+		t.Errorf("excursion without bars")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	trades := []Trade{
+		{Symbol: "AAPL", NetPNL: 10, GrossPNL: 12, Commission: 2},
+		{Symbol: "MSFT", NetPNL: -5, GrossPNL: -4, Commission: 1},
+		{Symbol: "AAPL", NetPNL: -1, GrossPNL: 0, Commission: 1},
+	}
+	sums := summarize(trades, func(t Trade) string { return t.Symbol })
+	if len(sums) != 2 || sums[0].Group != "AAPL" || sums[1].Group != "MSFT" {
+		t.Fatalf("groups %+v", sums)
+	}
+	if s := sums[0]; s.Trades != 2 || s.Winners != 1 || s.Losers != 1 || !near(s.NetPNL, 9) || !near(s.Commission, 3) {
+		t.Errorf("AAPL summary %+v", s)
+	}
+}